@@ -0,0 +1,199 @@
+package yarl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync/atomic"
+)
+
+// ErrDenied is returned by [Limiter.Check] and [Limiter.Peek] when the key is on
+// the Limiter's denylist. Middlewares answer it with HTTP 403 instead of 500.
+var ErrDenied = errors.New("yarl: key is denylisted")
+
+// Access is the verdict of an [AccessList] for a request.
+type Access int
+
+const (
+	// AccessDefault means no entry matched: the rules apply as usual.
+	AccessDefault Access = iota
+	// AccessAllow means an allowlist entry matched: the request is never limited.
+	AccessAllow
+	// AccessDeny means a denylist entry matched: the request is rejected outright.
+	AccessDeny
+)
+
+// AccessRules lists the entries of an [AccessList]. Denylist entries win over
+// allowlist entries.
+type AccessRules struct {
+	// AllowKeys and DenyKeys match the rate-limit key exactly.
+	AllowKeys, DenyKeys []string
+	// AllowCIDRs and DenyCIDRs match the client IP against ranges such as
+	// "10.0.0.0/8" or "2001:db8::/32"; a bare address matches only itself.
+	AllowCIDRs, DenyCIDRs []string
+	// AllowHeaders and DenyHeaders map a request header name to the values that
+	// match. They are only evaluated by the middlewares. Clients set most headers
+	// themselves (a User-Agent is trivial to fake): only allowlist a header that
+	// a trusted proxy sets or overwrites.
+	AllowHeaders, DenyHeaders map[string][]string
+}
+
+// AccessSubject is what an [AccessList] matches against.
+type AccessSubject struct {
+	// Key is the rate-limit key.
+	Key string
+	// IP is the client address; the zero value matches no CIDR.
+	IP netip.Addr
+	// Header returns the value of a request header; nil when there is no request.
+	Header func(name string) string
+}
+
+// AccessList holds allow and deny entries that are evaluated before any backend
+// call. It is safe for concurrent use and can be replaced at runtime with
+// [AccessList.Update]. Create one with [NewAccessList].
+type AccessList struct {
+	lists atomic.Pointer[accessLists]
+}
+
+type accessLists struct {
+	allow, deny accessEntries
+}
+
+type accessEntries struct {
+	keys     map[string]struct{}
+	prefixes []netip.Prefix
+	headers  map[string]map[string]struct{}
+}
+
+// NewAccessList creates an AccessList from rules.
+// It returns an error if a CIDR entry is invalid.
+func NewAccessList(rules AccessRules) (*AccessList, error) {
+	a := &AccessList{}
+	if err := a.Update(rules); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Update atomically replaces all entries with rules. On error the current
+// entries are kept.
+func (a *AccessList) Update(rules AccessRules) error {
+	allow, err := compileEntries(rules.AllowKeys, rules.AllowCIDRs, rules.AllowHeaders)
+	if err != nil {
+		return err
+	}
+	deny, err := compileEntries(rules.DenyKeys, rules.DenyCIDRs, rules.DenyHeaders)
+	if err != nil {
+		return err
+	}
+	a.lists.Store(&accessLists{allow: allow, deny: deny})
+	return nil
+}
+
+// Match returns the verdict for s. A nil *AccessList returns [AccessDefault].
+func (a *AccessList) Match(s AccessSubject) Access {
+	if a == nil {
+		return AccessDefault
+	}
+	lists := a.lists.Load()
+	switch {
+	case lists.deny.match(s):
+		return AccessDeny
+	case lists.allow.match(s):
+		return AccessAllow
+	default:
+		return AccessDefault
+	}
+}
+
+// WithAccessList makes the Limiter consult a before every [Limiter.Check] and
+// [Limiter.Peek]. The key is matched against the key entries, and the address
+// set with [NewClientIPContext], if any, against the CIDR entries. The key
+// itself is never matched against CIDRs, even when it is an IP address: keys
+// are often built from headers such as X-Forwarded-For that the client
+// controls. Allowlisted keys get an allowed result per rule without any
+// backend call; denylisted keys get [ErrDenied].
+func WithAccessList(a *AccessList) Option {
+	return func(l *Limiter) {
+		l.access = a
+	}
+}
+
+// accessResults returns the results for an allowlisted userKey, [ErrDenied] for a
+// denylisted one, and (nil, nil) when the rules apply.
+func (l *Limiter) accessResults(ctx context.Context, userKey string) ([]RuleResult, error) {
+	s := AccessSubject{Key: userKey}
+	s.IP, _ = ClientIPFromContext(ctx)
+	switch l.access.Match(s) {
+	case AccessDeny:
+		return nil, ErrDenied
+	case AccessAllow:
+		now := l.clock.Now()
+		results := make([]RuleResult, len(l.rules))
+		for i, rule := range l.rules {
+			results[i] = RuleResult{ID: rule.ID, Allowed: true, Max: rule.MaxRequests, ExpiresAt: now}
+		}
+		return results, nil
+	}
+	return nil, nil
+}
+
+func compileEntries(keys, cidrs []string, headers map[string][]string) (accessEntries, error) {
+	e := accessEntries{
+		keys:    make(map[string]struct{}, len(keys)),
+		headers: make(map[string]map[string]struct{}, len(headers)),
+	}
+	for _, k := range keys {
+		e.keys[k] = struct{}{}
+	}
+	for _, c := range cidrs {
+		p, err := parsePrefix(c)
+		if err != nil {
+			return accessEntries{}, err
+		}
+		e.prefixes = append(e.prefixes, p)
+	}
+	for name, values := range headers {
+		set := make(map[string]struct{}, len(values))
+		for _, v := range values {
+			set[v] = struct{}{}
+		}
+		e.headers[name] = set
+	}
+	return e, nil
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("yarl: invalid CIDR %q", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func (e accessEntries) match(s AccessSubject) bool {
+	if _, ok := e.keys[s.Key]; ok {
+		return true
+	}
+	if s.IP.IsValid() {
+		ip := s.IP.Unmap()
+		for _, p := range e.prefixes {
+			if p.Contains(ip) {
+				return true
+			}
+		}
+	}
+	if s.Header != nil {
+		for name, values := range e.headers {
+			if _, ok := values[s.Header(name)]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
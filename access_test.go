@@ -0,0 +1,108 @@
+package yarl
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessList_Match(t *testing.T) {
+	a, err := NewAccessList(AccessRules{
+		AllowKeys:    []string{"healthcheck"},
+		AllowCIDRs:   []string{"10.0.0.0/8", "2001:db8::/32"},
+		DenyKeys:     []string{"abuser"},
+		DenyCIDRs:    []string{"10.6.6.6", "192.0.2.0/24"},
+		AllowHeaders: map[string][]string{"User-Agent": {"kube-probe/1.30"}},
+		DenyHeaders:  map[string][]string{"X-Partner": {"revoked"}},
+	})
+	require.NoError(t, err)
+
+	header := func(kv ...string) func(string) string {
+		h := http.Header{}
+		for i := 0; i < len(kv); i += 2 {
+			h.Set(kv[i], kv[i+1])
+		}
+		return h.Get
+	}
+
+	tests := []struct {
+		name    string
+		subject AccessSubject
+		want    Access
+	}{
+		{"unknown key", AccessSubject{Key: "alice"}, AccessDefault},
+		{"allowed key", AccessSubject{Key: "healthcheck"}, AccessAllow},
+		{"denied key", AccessSubject{Key: "abuser"}, AccessDeny},
+		{"allowed range", AccessSubject{IP: netip.MustParseAddr("10.1.2.3")}, AccessAllow},
+		{"allowed IPv6 range", AccessSubject{IP: netip.MustParseAddr("2001:db8::1")}, AccessAllow},
+		{"IPv4-mapped address", AccessSubject{IP: netip.MustParseAddr("::ffff:10.1.2.3")}, AccessAllow},
+		{"deny wins over allow", AccessSubject{IP: netip.MustParseAddr("10.6.6.6")}, AccessDeny},
+		{"denied range", AccessSubject{IP: netip.MustParseAddr("192.0.2.77")}, AccessDeny},
+		{"outside ranges", AccessSubject{IP: netip.MustParseAddr("203.0.113.1")}, AccessDefault},
+		{"allowed header", AccessSubject{Header: header("User-Agent", "kube-probe/1.30")}, AccessAllow},
+		{"denied header", AccessSubject{Key: "healthcheck", Header: header("X-Partner", "revoked")}, AccessDeny},
+		{"other header value", AccessSubject{Header: header("User-Agent", "curl/8")}, AccessDefault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, a.Match(tt.subject))
+		})
+	}
+}
+
+func TestAccessList_Update(t *testing.T) {
+	a, err := NewAccessList(AccessRules{DenyKeys: []string{"alice"}})
+	require.NoError(t, err)
+	assert.Equal(t, AccessDeny, a.Match(AccessSubject{Key: "alice"}))
+
+	assert.Error(t, a.Update(AccessRules{DenyCIDRs: []string{"not-a-cidr"}}))
+	assert.Equal(t, AccessDeny, a.Match(AccessSubject{Key: "alice"}), "a failed update keeps the current entries")
+
+	require.NoError(t, a.Update(AccessRules{AllowKeys: []string{"alice"}}))
+	assert.Equal(t, AccessAllow, a.Match(AccessSubject{Key: "alice"}))
+
+	var nilList *AccessList
+	assert.Equal(t, AccessDefault, nilList.Match(AccessSubject{Key: "alice"}))
+}
+
+func TestLimiter_WithAccessList(t *testing.T) {
+	ctx := context.Background()
+	a, err := NewAccessList(AccessRules{
+		AllowCIDRs: []string{"10.0.0.0/8"},
+		DenyKeys:   []string{"abuser"},
+	})
+	require.NoError(t, err)
+	b := peekBackend{newMockBackend(time.Minute, nil)}
+	l := NewWithOptions(b, []Rule{{ID: "r1", TTL: time.Minute, MaxRequests: 1}}, WithAccessList(a))
+
+	partner := NewClientIPContext(ctx, netip.MustParseAddr("10.1.2.3"))
+	for range 3 {
+		results, err := l.Check(partner, "partner")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.True(t, results[0].Allowed)
+	}
+	assert.Empty(t, b.counts, "allowlisted keys must not reach the backend")
+
+	// A key that looks like an allowlisted address is not trusted: it may come
+	// from a client-supplied header.
+	_, err = l.Check(ctx, "10.1.2.3")
+	require.NoError(t, err)
+	results, err := l.Check(ctx, "10.1.2.3")
+	require.NoError(t, err)
+	assert.False(t, results[0].Allowed)
+
+	_, err = l.Check(ctx, "abuser")
+	assert.ErrorIs(t, err, ErrDenied)
+	_, err = l.Peek(ctx, "abuser")
+	assert.ErrorIs(t, err, ErrDenied)
+
+	_, err = l.Check(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), b.counts["r1:alice"])
+}
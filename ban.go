@@ -0,0 +1,199 @@
+package yarl
+
+import (
+	"context"
+	"time"
+)
+
+// BanPolicy temporarily blocks keys that keep violating the rules.
+//
+// Every [Limiter.Check] that denies a key counts as one violation. Once a key
+// collects Violations violations within Period, it is banned for Duration; each
+// further ban of the same key doubles the duration, up to MaxDuration. While a
+// key is banned Check reports every rule as denied and [RuleResult.Banned],
+// without counting the request, at the cost of one backend read.
+//
+// Ban state lives in the backend, next to the counters, under the keys
+// "{ID}.ban:{userKey}", "{ID}.offenses:{userKey}" and "{ID}.violations:{userKey}".
+// The backend must implement [PeekBackend]; [ResetBackend] is used when available
+// to clear the violations of a freshly banned key. A denial caused by a full
+// backend refusing a new key ([Saturated]) is not a violation, and
+// [Limiter.Check] fails with [ErrBackendFull] when the ban state of a real
+// violation cannot be stored.
+type BanPolicy struct {
+	// ID namespaces the ban keys. Defaults to "ban"; limiters sharing a backend
+	// need distinct IDs.
+	ID string
+	// Violations is how many denied checks within Period trigger a ban. Defaults to 1.
+	Violations int64
+	// Period is the window in which violations are counted. Defaults to 1m.
+	Period time.Duration
+	// Duration is the length of the first ban. Defaults to 1m.
+	Duration time.Duration
+	// MaxDuration caps the escalating ban duration. Defaults to 24h.
+	MaxDuration time.Duration
+	// Forget is how long, from a key's first ban, further bans keep escalating;
+	// afterwards the next ban starts again from Duration. Defaults to 2×MaxDuration.
+	Forget time.Duration
+}
+
+// WithBanPolicy bans keys that keep violating the Limiter's rules, as described
+// by p. [Limiter.Check] returns [ErrUnsupported] if the backend does not
+// implement [PeekBackend].
+func WithBanPolicy(p BanPolicy) Option {
+	if p.ID == "" {
+		p.ID = "ban"
+	}
+	if p.Violations < 1 {
+		p.Violations = 1
+	}
+	if p.Period <= 0 {
+		p.Period = time.Minute
+	}
+	if p.Duration <= 0 {
+		p.Duration = time.Minute
+	}
+	if p.MaxDuration <= 0 {
+		p.MaxDuration = 24 * time.Hour
+	}
+	if p.Forget <= 0 {
+		p.Forget = 2 * p.MaxDuration
+	}
+	return func(l *Limiter) {
+		l.ban = &banPolicy{p}
+	}
+}
+
+type banPolicy struct {
+	BanPolicy
+}
+
+func (b *banPolicy) banKey(userKey string) string        { return b.ID + ".ban:" + userKey }
+func (b *banPolicy) offensesKey(userKey string) string   { return b.ID + ".offenses:" + userKey }
+func (b *banPolicy) violationsKey(userKey string) string { return b.ID + ".violations:" + userKey }
+
+// check rejects banned keys before counting, and records a violation when the
+// counted request is denied.
+func (b *banPolicy) check(ctx context.Context, l *Limiter, userKey string) ([]RuleResult, error) {
+	pb, ok := l.backend.(PeekBackend)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	if results, err := b.banned(ctx, l, pb, userKey); err != nil || results != nil {
+		return results, err
+	}
+
+	results, err := l.count(ctx, userKey)
+	if err != nil {
+		return nil, err
+	}
+	if allowed, _ := Summarize(results); allowed || saturated(results) {
+		return results, nil // a key the full backend refused is no violation of its own
+	}
+	return b.violation(ctx, l, results, userKey)
+}
+
+// saturated reports whether the backend refused to store a counter of results.
+func saturated(results []RuleResult) bool {
+	for _, res := range results {
+		if res.Current == Saturated {
+			return true
+		}
+	}
+	return false
+}
+
+// incBanState increments a ban-state key, failing with [ErrBackendFull] when
+// the backend refuses to store it: a ban that is reported but never stored
+// would be lifted on the next request.
+func incBanState(ctx context.Context, backend Backend, key string, ttl time.Duration) (int64, time.Duration, error) {
+	count, remaining, err := backend.IncAndGetTTL(ctx, key, ttl)
+	if err == nil && count == Saturated {
+		return 0, 0, ErrBackendFull
+	}
+	return count, remaining, err
+}
+
+// banned returns one banned result per rule if userKey is serving a ban, or nil.
+func (b *banPolicy) banned(ctx context.Context, l *Limiter, pb PeekBackend, userKey string) ([]RuleResult, error) {
+	count, remaining, err := pb.Get(ctx, b.banKey(userKey))
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || remaining <= 0 {
+		return nil, nil
+	}
+
+	results := make([]RuleResult, len(l.rules))
+	for i, rule := range l.rules {
+		results[i] = RuleResult{ID: rule.ID, Max: rule.MaxRequests}
+	}
+	return ban(results, remaining, l.clock.Now()), nil
+}
+
+// violation counts a denied check of userKey and bans it once the policy's
+// threshold is reached.
+func (b *banPolicy) violation(ctx context.Context, l *Limiter, results []RuleResult, userKey string) ([]RuleResult, error) {
+	backend := l.backend
+	violations, _, err := incBanState(ctx, backend, b.violationsKey(userKey), b.Period)
+	if err != nil {
+		return nil, err
+	}
+	if violations < b.Violations {
+		return results, nil
+	}
+
+	offenses, _, err := incBanState(ctx, backend, b.offensesKey(userKey), b.Forget)
+	if err != nil {
+		return nil, err
+	}
+	// A concurrent request may have created the ban first; report its remainder.
+	_, remaining, err := incBanState(ctx, backend, b.banKey(userKey), b.duration(offenses))
+	if err != nil {
+		return nil, err
+	}
+	if rb, ok := backend.(ResetBackend); ok {
+		if err := rb.Reset(ctx, b.violationsKey(userKey)); err != nil {
+			return nil, err
+		}
+	}
+	return ban(results, remaining, l.clock.Now()), nil
+}
+
+// duration returns the length of the n-th ban: Duration doubled n-1 times,
+// capped at MaxDuration. It takes at most 63 doublings whatever n is.
+func (b *banPolicy) duration(n int64) time.Duration {
+	d := b.Duration
+	for i := int64(1); i < n && d > 0 && d < b.MaxDuration; i++ {
+		d *= 2
+	}
+	if d <= 0 {
+		if b.Duration <= 0 {
+			return 0
+		}
+		return b.MaxDuration // doubling overflowed
+	}
+	return min(d, b.MaxDuration)
+}
+
+// reset lifts the ban of userKey and forgets its violations and offenses.
+func (b *banPolicy) reset(ctx context.Context, rb ResetBackend, userKey string) error {
+	for _, key := range []string{b.banKey(userKey), b.offensesKey(userKey), b.violationsKey(userKey)} {
+		if err := rb.Reset(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ban marks every result as denied by a ban expiring after remaining.
+func ban(results []RuleResult, remaining time.Duration, now time.Time) []RuleResult {
+	expiresAt := now.Add(remaining)
+	for i := range results {
+		r := &results[i]
+		r.Allowed, r.Banned, r.WouldBlock = false, true, false
+		r.RetryAfter = remaining
+		r.ExpiresAt = expiresAt
+	}
+	return results
+}
@@ -0,0 +1,123 @@
+package yarl
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (b *windowBackend) Get(_ context.Context, key string) (int64, time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	w, ok := b.windows[key]
+	if !ok || !w.expiresAt.After(now) {
+		return 0, 0, nil
+	}
+	return w.count, w.expiresAt.Sub(now), nil
+}
+
+func (b *windowBackend) Reset(_ context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.windows, key)
+	return nil
+}
+
+func TestBanPolicy_Escalates(t *testing.T) {
+	ctx := context.Background()
+	b := newWindowBackend()
+	l := NewWithOptions(b, []Rule{{ID: "r1", TTL: 20 * time.Millisecond, MaxRequests: 1}},
+		WithBanPolicy(BanPolicy{Violations: 2, Period: time.Minute, Duration: 60 * time.Millisecond, MaxDuration: 100 * time.Millisecond}))
+
+	check := func() RuleResult {
+		t.Helper()
+		results, err := l.Check(ctx, "alice")
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		return results[0]
+	}
+
+	assert.True(t, check().Allowed)
+	res := check() // first violation
+	assert.False(t, res.Allowed)
+	assert.False(t, res.Banned)
+
+	res = check() // second violation: banned
+	assert.True(t, res.Banned)
+	assert.InDelta(t, 60*time.Millisecond, res.RetryAfter, float64(5*time.Millisecond))
+
+	calls := b.calls
+	res = check()
+	assert.True(t, res.Banned)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, calls, b.calls, "banned checks must not count")
+
+	time.Sleep(70 * time.Millisecond)
+	assert.True(t, check().Allowed, "ban expired")
+	check()
+	res = check()
+	require.True(t, res.Banned)
+	assert.InDelta(t, 100*time.Millisecond, res.RetryAfter, float64(5*time.Millisecond), "second ban doubles, capped at MaxDuration")
+}
+
+func TestBanPolicy_PeekAndReset(t *testing.T) {
+	ctx := context.Background()
+	l := NewWithOptions(newWindowBackend(), []Rule{{ID: "r1", TTL: time.Minute, MaxRequests: 1}},
+		WithBanPolicy(BanPolicy{Period: time.Minute, Duration: time.Minute}))
+
+	for range 2 {
+		_, err := l.Check(ctx, "alice")
+		require.NoError(t, err)
+	}
+
+	results, err := l.Peek(ctx, "alice")
+	require.NoError(t, err)
+	assert.True(t, results[0].Banned)
+
+	require.NoError(t, l.Reset(ctx, "alice"))
+	results, err = l.Peek(ctx, "alice")
+	require.NoError(t, err)
+	assert.False(t, results[0].Banned)
+	assert.True(t, results[0].Allowed)
+}
+
+func TestBanPolicy_RequiresPeekBackend(t *testing.T) {
+	l := NewWithOptions(newMockBackend(time.Minute, nil), []Rule{{ID: "r1", TTL: time.Minute, MaxRequests: 1}},
+		WithBanPolicy(BanPolicy{Period: time.Minute, Duration: time.Minute}))
+
+	_, err := l.Check(context.Background(), "alice")
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestBanPolicy_Duration(t *testing.T) {
+	b := banPolicy{BanPolicy{Duration: time.Second, MaxDuration: 10 * time.Second}}
+	assert.Equal(t, time.Second, b.duration(1))
+	assert.Equal(t, 2*time.Second, b.duration(2))
+	assert.Equal(t, 8*time.Second, b.duration(4))
+	assert.Equal(t, 10*time.Second, b.duration(5))
+	assert.Equal(t, 10*time.Second, b.duration(1000))
+	assert.Equal(t, 10*time.Second, b.duration(math.MaxInt64))
+
+	b = banPolicy{BanPolicy{Duration: time.Hour, MaxDuration: math.MaxInt64}}
+	assert.Equal(t, time.Duration(math.MaxInt64), b.duration(math.MaxInt64), "overflow caps at MaxDuration")
+
+	b = banPolicy{BanPolicy{MaxDuration: time.Hour}}
+	assert.Zero(t, b.duration(math.MaxInt64), "a zero Duration must not loop")
+}
+
+func TestWithBanPolicy_Defaults(t *testing.T) {
+	l := NewWithOptions(newMockBackend(time.Minute, nil), nil, WithBanPolicy(BanPolicy{}))
+	assert.Equal(t, BanPolicy{
+		ID:          "ban",
+		Violations:  1,
+		Period:      time.Minute,
+		Duration:    time.Minute,
+		MaxDuration: 24 * time.Hour,
+		Forget:      48 * time.Hour,
+	}, l.ban.BanPolicy)
+}
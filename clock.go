@@ -0,0 +1,32 @@
+package yarl
+
+import "time"
+
+// Clock is the time source of a [Limiter] or a [ConcurrencyLimiter]. The
+// default, [SystemClock], reads the system clock; tests can inject a
+// controllable one, such as the fake clock of package yarltest, with
+// [WithClock] or [WithConcurrencyClock].
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After waits for d to elapse and then sends the current time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the [Clock] backed by package time.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// WithClock makes the Limiter read the time from c: result expiry times and the
+// sleeps of [Limiter.Wait] follow c instead of the system clock. Use it in tests
+// together with a backend on the same clock, so windows expire instantly when
+// the clock is advanced.
+func WithClock(c Clock) Option {
+	return func(l *Limiter) {
+		l.clock = c
+	}
+}
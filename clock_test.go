@@ -0,0 +1,82 @@
+package yarl_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/integration/backend/lrubackend"
+	"github.com/logocomune/yarl/v4/yarltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithClock_WindowExpiry(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	rules := []yarl.Rule{{ID: "r1", TTL: time.Minute, MaxRequests: 1}}
+	l := yarl.NewWithOptions(lrubackend.New(rules, 10, lrubackend.WithClock(clock)), rules, yarl.WithClock(clock))
+
+	_, err := l.Check(ctx, "alice")
+	require.NoError(t, err)
+
+	clock.Advance(20 * time.Second)
+	results, err := l.Check(ctx, "alice")
+	require.NoError(t, err)
+	assert.False(t, results[0].Allowed)
+	assert.Equal(t, 40*time.Second, results[0].RetryAfter)
+	assert.Equal(t, clock.Now().Add(40*time.Second), results[0].ExpiresAt)
+
+	clock.Advance(40 * time.Second)
+	results, err = l.Check(ctx, "alice")
+	require.NoError(t, err)
+	assert.True(t, results[0].Allowed, "the window must expire when the clock is advanced")
+	assert.Equal(t, int64(1), results[0].Current)
+}
+
+func TestWithClock_Wait(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	rules := []yarl.Rule{{ID: "r1", TTL: time.Hour, MaxRequests: 1}}
+	l := yarl.NewWithOptions(lrubackend.New(rules, 10, lrubackend.WithClock(clock)), rules, yarl.WithClock(clock))
+
+	require.NoError(t, l.Wait(ctx, "alice"))
+
+	done := make(chan error, 1)
+	go func() { done <- l.Wait(ctx, "alice") }()
+
+	require.Eventually(t, func() bool { return clock.Waiters() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(time.Hour)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the clock was advanced")
+	}
+}
+
+func TestWithConcurrencyClock(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	c := yarl.NewConcurrencyWithOptions(lrubackend.New(nil, 10, lrubackend.WithClock(clock)),
+		[]yarl.ConcurrencyRule{{ID: "r", MaxInFlight: 1, LeaseTTL: time.Minute}},
+		yarl.WithConcurrencyClock(clock))
+
+	_, results, err := c.Acquire(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now().Add(time.Minute), results[0].ExpiresAt)
+
+	clock.Advance(20 * time.Second)
+	lease, results, err := c.Acquire(ctx, "alice")
+	require.NoError(t, err)
+	assert.Nil(t, lease)
+	assert.Equal(t, 40*time.Second, results[0].RetryAfter)
+	assert.Equal(t, clock.Now().Add(40*time.Second), results[0].ExpiresAt)
+
+	clock.Advance(40 * time.Second)
+	lease, _, err = c.Acquire(ctx, "alice")
+	require.NoError(t, err)
+	assert.NotNil(t, lease, "the lease must expire when the clock is advanced")
+}
@@ -0,0 +1,147 @@
+package yarl
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ConcurrencyRule defines one in-flight limit: at most MaxInFlight requests for
+// the same user key may hold a lease at once.
+// Each ConcurrencyRule gets its own key in the backend: "{ID}:{userKey}".
+type ConcurrencyRule struct {
+	ID          string        // key namespace; must be unique per ConcurrencyLimiter
+	MaxInFlight int64         // allowed concurrent leases
+	LeaseTTL    time.Duration // leases not released within LeaseTTL expire, so crashed holders do not leak slots
+}
+
+// LeaseBackend is the storage interface for [ConcurrencyLimiter].
+// Implementations must be safe for concurrent use.
+type LeaseBackend interface {
+	// Acquire atomically drops the expired leases of key and, if fewer than max
+	// remain, adds leaseID with an expiry of ttl. It returns whether the lease was
+	// granted, the number of leases held after the call, and the time until the
+	// oldest held lease expires.
+	Acquire(ctx context.Context, key, leaseID string, max int64, ttl time.Duration) (acquired bool, inFlight int64, oldest time.Duration, err error)
+	// Release removes leaseID from key. Releasing an unknown or expired lease is not an error.
+	Release(ctx context.Context, key, leaseID string) error
+}
+
+// ConcurrencyLimiter evaluates a fixed set of [ConcurrencyRule] values on every
+// [ConcurrencyLimiter.Acquire] call.
+type ConcurrencyLimiter struct {
+	backend LeaseBackend
+	rules   []ConcurrencyRule
+	clock   Clock
+}
+
+// NewConcurrency creates a ConcurrencyLimiter backed by b. Rules are fixed for the
+// lifetime of the ConcurrencyLimiter. Each rule must have a unique ID.
+func NewConcurrency(b LeaseBackend, rules ...ConcurrencyRule) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{backend: b, rules: rules, clock: SystemClock}
+}
+
+// ConcurrencyOption configures a [ConcurrencyLimiter] created with
+// [NewConcurrencyWithOptions].
+type ConcurrencyOption func(*ConcurrencyLimiter)
+
+// NewConcurrencyWithOptions creates a ConcurrencyLimiter like [NewConcurrency]
+// and applies opts to it.
+func NewConcurrencyWithOptions(b LeaseBackend, rules []ConcurrencyRule, opts ...ConcurrencyOption) *ConcurrencyLimiter {
+	c := NewConcurrency(b, rules...)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithConcurrencyClock makes the ConcurrencyLimiter compute the expiry times of
+// its results from c instead of the system clock, like [WithClock] does for a
+// [Limiter].
+func WithConcurrencyClock(c Clock) ConcurrencyOption {
+	return func(l *ConcurrencyLimiter) {
+		l.clock = c
+	}
+}
+
+// Lease is a set of slots held by one request, one per [ConcurrencyRule].
+// Call [Lease.Release] when the request completes.
+type Lease struct {
+	backend LeaseBackend
+	id      string
+	keys    []string
+}
+
+// Acquire tries to take one slot of every rule for userKey and returns one
+// [RuleResult] per rule. For each result, Current is the number of leases held
+// and, when the slot was refused, RetryAfter is the time until the oldest lease expires.
+//
+// The lease is granted only if every rule has a free slot; otherwise the slots
+// already taken are given back and the returned *Lease is nil.
+func (c *ConcurrencyLimiter) Acquire(ctx context.Context, userKey string) (*Lease, []RuleResult, error) {
+	lease := &Lease{backend: c.backend, id: newLeaseID(), keys: make([]string, 0, len(c.rules))}
+	results := make([]RuleResult, 0, len(c.rules))
+	granted := true
+	now := c.clock.Now()
+
+	for _, rule := range c.rules {
+		key := rule.ID + ":" + userKey
+		acquired, inFlight, oldest, err := c.backend.Acquire(ctx, key, lease.id, rule.MaxInFlight, rule.LeaseTTL)
+		if err != nil {
+			return nil, nil, errors.Join(err, lease.Release(context.WithoutCancel(ctx)))
+		}
+		if acquired {
+			lease.keys = append(lease.keys, key)
+		}
+		granted = granted && acquired
+		results = append(results, toConcurrencyResult(rule, acquired, inFlight, oldest, now))
+	}
+
+	if !granted {
+		return nil, results, lease.Release(context.WithoutCancel(ctx))
+	}
+	return lease, results, nil
+}
+
+// Release gives back every slot held by the lease. It is safe to call on a nil Lease.
+func (l *Lease) Release(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	var errs []error
+	for _, key := range l.keys {
+		if err := l.backend.Release(ctx, key, l.id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	l.keys = nil
+	return errors.Join(errs...)
+}
+
+func toConcurrencyResult(rule ConcurrencyRule, acquired bool, inFlight int64, oldest time.Duration, now time.Time) RuleResult {
+	r := RuleResult{
+		ID:        rule.ID,
+		Allowed:   acquired,
+		Current:   inFlight,
+		Max:       rule.MaxInFlight,
+		ExpiresAt: now.Add(rule.LeaseTTL),
+	}
+	if !acquired {
+		if oldest <= 0 {
+			// MaxInFlight == 0: no lease will ever be freed, report one lease TTL.
+			oldest = rule.LeaseTTL
+		}
+		r.ExpiresAt = now.Add(oldest)
+		r.RetryAfter = oldest
+	}
+	return r
+}
+
+// newLeaseID returns a random 128-bit lease identifier.
+func newLeaseID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
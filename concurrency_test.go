@@ -0,0 +1,140 @@
+package yarl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockLeaseBackend keeps leases in a map and ignores expiry.
+type mockLeaseBackend struct {
+	mu         sync.Mutex
+	leases     map[string]map[string]bool
+	acquireErr map[string]error
+	releases   int
+}
+
+func newMockLeaseBackend() *mockLeaseBackend {
+	return &mockLeaseBackend{leases: make(map[string]map[string]bool), acquireErr: make(map[string]error)}
+}
+
+func (m *mockLeaseBackend) Acquire(_ context.Context, key, leaseID string, max int64, ttl time.Duration) (bool, int64, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.acquireErr[key]; err != nil {
+		return false, 0, 0, err
+	}
+	held := m.leases[key]
+	if held == nil {
+		held = make(map[string]bool)
+		m.leases[key] = held
+	}
+	if int64(len(held)) >= max {
+		return false, int64(len(held)), ttl / 2, nil
+	}
+	held[leaseID] = true
+	return true, int64(len(held)), ttl, nil
+}
+
+func (m *mockLeaseBackend) Release(_ context.Context, key, leaseID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.releases++
+	delete(m.leases[key], leaseID)
+	return nil
+}
+
+func (m *mockLeaseBackend) held(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.leases[key])
+}
+
+func TestConcurrencyLimiter_AcquireRelease(t *testing.T) {
+	ctx := context.Background()
+	b := newMockLeaseBackend()
+	c := NewConcurrency(b, ConcurrencyRule{ID: "exports", MaxInFlight: 2, LeaseTTL: time.Minute})
+
+	l1, results, err := c.Acquire(ctx, "u")
+	require.NoError(t, err)
+	require.NotNil(t, l1)
+	require.Len(t, results, 1)
+	assert.True(t, results[0].Allowed)
+	assert.Equal(t, int64(1), results[0].Current)
+	assert.Equal(t, int64(2), results[0].Max)
+
+	l2, _, err := c.Acquire(ctx, "u")
+	require.NoError(t, err)
+	require.NotNil(t, l2)
+
+	l3, results, err := c.Acquire(ctx, "u")
+	require.NoError(t, err)
+	assert.Nil(t, l3, "third concurrent lease must be refused")
+	assert.False(t, results[0].Allowed)
+	assert.Equal(t, 30*time.Second, results[0].RetryAfter)
+
+	require.NoError(t, l1.Release(ctx))
+	assert.Equal(t, 1, b.held("exports:u"))
+
+	l3, _, err = c.Acquire(ctx, "u")
+	require.NoError(t, err)
+	assert.NotNil(t, l3, "a released slot must be reusable")
+}
+
+func TestConcurrencyLimiter_PartialAcquireIsRolledBack(t *testing.T) {
+	ctx := context.Background()
+	b := newMockLeaseBackend()
+	c := NewConcurrency(b,
+		ConcurrencyRule{ID: "per-user", MaxInFlight: 5, LeaseTTL: time.Minute},
+		ConcurrencyRule{ID: "global", MaxInFlight: 0, LeaseTTL: time.Minute},
+	)
+
+	lease, results, err := c.Acquire(ctx, "u")
+	require.NoError(t, err)
+	assert.Nil(t, lease)
+	require.Len(t, results, 2, "all rules must be evaluated")
+	assert.True(t, results[0].Allowed)
+	assert.False(t, results[1].Allowed)
+	assert.Equal(t, 0, b.held("per-user:u"), "slot taken on the first rule must be given back")
+}
+
+func TestConcurrencyLimiter_BackendError(t *testing.T) {
+	ctx := context.Background()
+	b := newMockLeaseBackend()
+	b.acquireErr["global:u"] = errors.New("storage down")
+	c := NewConcurrency(b,
+		ConcurrencyRule{ID: "per-user", MaxInFlight: 5, LeaseTTL: time.Minute},
+		ConcurrencyRule{ID: "global", MaxInFlight: 5, LeaseTTL: time.Minute},
+	)
+
+	lease, _, err := c.Acquire(ctx, "u")
+	require.Error(t, err)
+	assert.Nil(t, lease)
+	assert.Equal(t, 0, b.held("per-user:u"), "slots taken before the error must be given back")
+}
+
+func TestLease_ReleaseTwiceAndNil(t *testing.T) {
+	ctx := context.Background()
+	b := newMockLeaseBackend()
+	c := NewConcurrency(b, ConcurrencyRule{ID: "r", MaxInFlight: 1, LeaseTTL: time.Minute})
+
+	lease, _, err := c.Acquire(ctx, "u")
+	require.NoError(t, err)
+	require.NoError(t, lease.Release(ctx))
+	require.NoError(t, lease.Release(ctx))
+	assert.Equal(t, 1, b.releases, "a second Release must be a no-op")
+
+	var nilLease *Lease
+	assert.NoError(t, nilLease.Release(ctx))
+}
+
+func TestToConcurrencyResult_ZeroMax(t *testing.T) {
+	r := toConcurrencyResult(ConcurrencyRule{ID: "r", MaxInFlight: 0, LeaseTTL: time.Minute}, false, 0, 0, time.Now())
+	assert.False(t, r.Allowed)
+	assert.Equal(t, time.Minute, r.RetryAfter, "RetryAfter must be > 0 when not allowed")
+}
@@ -0,0 +1,38 @@
+package yarl
+
+import (
+	"context"
+	"net/netip"
+)
+
+type resultsContextKey struct{}
+
+type clientIPContextKey struct{}
+
+// NewContext returns a copy of ctx that carries results.
+// Middlewares use it to expose the outcome of [Limiter.Check] to downstream handlers.
+func NewContext(ctx context.Context, results []RuleResult) context.Context {
+	return context.WithValue(ctx, resultsContextKey{}, results)
+}
+
+// FromContext returns the results stored in ctx by [NewContext].
+// ok is false when ctx carries no results.
+func FromContext(ctx context.Context) (results []RuleResult, ok bool) {
+	results, ok = ctx.Value(resultsContextKey{}).([]RuleResult)
+	return results, ok
+}
+
+// NewClientIPContext returns a copy of ctx that carries the client address ip,
+// which the CIDR entries of the Limiter's [AccessList] are matched against.
+// Only pass an address the client cannot choose, such as the connection's
+// peer; the middlewares pass their ClientIP.
+func NewClientIPContext(ctx context.Context, ip netip.Addr) context.Context {
+	return context.WithValue(ctx, clientIPContextKey{}, ip)
+}
+
+// ClientIPFromContext returns the address stored in ctx by [NewClientIPContext].
+// ok is false when ctx carries none.
+func ClientIPFromContext(ctx context.Context) (ip netip.Addr, ok bool) {
+	ip, ok = ctx.Value(clientIPContextKey{}).(netip.Addr)
+	return ip, ok
+}
@@ -0,0 +1,287 @@
+// Package backendtest is a conformance suite for [yarl.Backend] implementations.
+//
+// Call [Run] from a test of the backend's package:
+//
+//	func TestConformance(t *testing.T) {
+//		backendtest.Run(t, func(t *testing.T) yarl.Backend {
+//			return mybackend.New(...)
+//		})
+//	}
+//
+// The suite checks the contract of [yarl.Backend.IncAndGetTTL]: increments,
+// the TTL set only on creation, reset after expiry, key isolation, atomicity
+// under concurrency and context cancellation. It also checks
+// [yarl.BatchBackend], [yarl.PeekBackend], [yarl.ResetBackend] and
+// [yarl.RefundBackend] when the backend implements them. It runs on the real
+// clock and sleeps about 1.5s in total; TTLs are whole seconds so backends
+// with second resolution pass.
+package backendtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns the backend under test. It is called once per subtest; backends
+// that share state between calls, such as Redis, are fine because every subtest
+// uses fresh random keys. Call t.Skip from the factory when the backend is
+// unavailable and t.Cleanup to release it.
+type Factory func(t *testing.T) yarl.Backend
+
+const (
+	window = time.Minute // TTL of counters that must not expire during a test
+	short  = time.Second // TTL of counters that must expire during a test
+)
+
+// Run runs the conformance suite against the backends returned by factory.
+func Run(t *testing.T, factory Factory) {
+	t.Run("Increments", func(t *testing.T) { testIncrements(t, factory(t)) })
+	t.Run("TTLNotRefreshedAndExpiry", func(t *testing.T) { testTTLNotRefreshedAndExpiry(t, factory(t)) })
+	t.Run("KeyIsolation", func(t *testing.T) { testKeyIsolation(t, factory(t)) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, factory(t)) })
+	t.Run("ContextCanceled", func(t *testing.T) { testContextCanceled(t, factory(t)) })
+	t.Run("BatchEqualsSerial", func(t *testing.T) { testBatchEqualsSerial(t, factory(t)) })
+	t.Run("Peek", func(t *testing.T) { testPeek(t, factory(t)) })
+	t.Run("Reset", func(t *testing.T) { testReset(t, factory(t)) })
+	t.Run("Decrement", func(t *testing.T) { testDecrement(t, factory(t)) })
+}
+
+// key returns a key in the "{ruleID}:{userKey}" format that no other test uses.
+func key(t *testing.T) string {
+	t.Helper()
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "backendtest:" + hex.EncodeToString(b)
+}
+
+func testIncrements(t *testing.T, b yarl.Backend) {
+	ctx := context.Background()
+	k := key(t)
+
+	count, remaining, err := b.IncAndGetTTL(ctx, k, window)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.InDelta(t, window, remaining, float64(time.Second), "a new key must report remaining ≈ ttl")
+
+	for want := int64(2); want <= 5; want++ {
+		count, _, err = b.IncAndGetTTL(ctx, k, window)
+		require.NoError(t, err)
+		assert.Equal(t, want, count)
+	}
+}
+
+func testTTLNotRefreshedAndExpiry(t *testing.T, b yarl.Backend) {
+	ctx := context.Background()
+	long, expiring := key(t), key(t)
+
+	_, _, err := b.IncAndGetTTL(ctx, long, window)
+	require.NoError(t, err)
+	_, _, err = b.IncAndGetTTL(ctx, expiring, short)
+	require.NoError(t, err)
+	_, _, err = b.IncAndGetTTL(ctx, expiring, short)
+	require.NoError(t, err)
+
+	time.Sleep(short + 500*time.Millisecond)
+
+	count, remaining, err := b.IncAndGetTTL(ctx, long, window)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Less(t, remaining, window-time.Second, "an increment must not refresh the TTL")
+	assert.Greater(t, remaining, time.Duration(0))
+
+	count, remaining, err = b.IncAndGetTTL(ctx, expiring, short)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "an expired key must restart at 1")
+	assert.InDelta(t, short, remaining, float64(time.Second), "an expired key must get a fresh TTL")
+}
+
+func testKeyIsolation(t *testing.T, b yarl.Backend) {
+	ctx := context.Background()
+	user := key(t)
+	a, other := user, "backendtest-other"+user[len("backendtest"):]
+
+	for range 3 {
+		_, _, err := b.IncAndGetTTL(ctx, a, window)
+		require.NoError(t, err)
+	}
+	count, _, err := b.IncAndGetTTL(ctx, other, window)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "keys with the same user part but another rule must be independent")
+
+	count, _, err = b.IncAndGetTTL(ctx, a+"x", window)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "keys must not match by prefix")
+}
+
+func testConcurrency(t *testing.T, b yarl.Backend) {
+	const goroutines, perGoroutine = 20, 25
+	ctx := context.Background()
+	k := key(t)
+
+	var (
+		mu     sync.Mutex
+		counts []int64
+		wg     sync.WaitGroup
+	)
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perGoroutine {
+				count, _, err := b.IncAndGetTTL(ctx, k, window)
+				if !assert.NoError(t, err) {
+					return
+				}
+				mu.Lock()
+				counts = append(counts, count)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, counts, goroutines*perGoroutine)
+	sort.Slice(counts, func(i, j int) bool { return counts[i] < counts[j] })
+	for i, c := range counts {
+		if !assert.Equal(t, int64(i+1), c, "concurrent increments must each return a distinct count") {
+			return
+		}
+	}
+}
+
+func testContextCanceled(t *testing.T, b yarl.Backend) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	k := key(t)
+
+	_, _, err := b.IncAndGetTTL(ctx, k, window)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	count, _, err := b.IncAndGetTTL(context.Background(), k, window)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "a canceled call must not increment")
+
+	if bb, ok := b.(yarl.BatchBackend); ok {
+		_, err := bb.IncAndGetTTLBatch(ctx, []yarl.BatchEntry{{Key: k, TTL: window}})
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+}
+
+func testBatchEqualsSerial(t *testing.T, b yarl.Backend) {
+	bb, ok := b.(yarl.BatchBackend)
+	if !ok {
+		t.Skip("backend does not implement yarl.BatchBackend")
+	}
+	ctx := context.Background()
+	batchKeys := []string{key(t), key(t), key(t)}
+	serialKeys := []string{key(t), key(t), key(t)}
+	ttls := []time.Duration{window, 2 * window, window}
+
+	// Give the second key a head start so the counts differ.
+	for _, k := range []string{batchKeys[1], serialKeys[1]} {
+		_, _, err := b.IncAndGetTTL(ctx, k, ttls[1])
+		require.NoError(t, err)
+	}
+
+	entries := make([]yarl.BatchEntry, len(batchKeys))
+	for i, k := range batchKeys {
+		entries[i] = yarl.BatchEntry{Key: k, TTL: ttls[i]}
+	}
+	batch, err := bb.IncAndGetTTLBatch(ctx, entries)
+	require.NoError(t, err)
+	require.Len(t, batch, len(entries))
+
+	for i, k := range serialKeys {
+		count, remaining, err := b.IncAndGetTTL(ctx, k, ttls[i])
+		require.NoError(t, err)
+		assert.Equal(t, count, batch[i].Count, "entry %d", i)
+		assert.InDelta(t, remaining, batch[i].Remaining, float64(time.Second), "entry %d", i)
+	}
+
+	// The same key twice in one batch counts twice.
+	k := key(t)
+	batch, err = bb.IncAndGetTTLBatch(ctx, []yarl.BatchEntry{{Key: k, TTL: window}, {Key: k, TTL: window}})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, []int64{batch[0].Count, batch[1].Count})
+}
+
+func testPeek(t *testing.T, b yarl.Backend) {
+	pb, ok := b.(yarl.PeekBackend)
+	if !ok {
+		t.Skip("backend does not implement yarl.PeekBackend")
+	}
+	ctx := context.Background()
+	k := key(t)
+
+	count, remaining, err := pb.Get(ctx, k)
+	require.NoError(t, err)
+	assert.Zero(t, count, "a missing key must read as 0")
+	assert.Zero(t, remaining)
+
+	for range 2 {
+		_, _, err = b.IncAndGetTTL(ctx, k, window)
+		require.NoError(t, err)
+	}
+	for range 2 {
+		count, remaining, err = pb.Get(ctx, k)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), count, "Get must not increment")
+		assert.InDelta(t, window, remaining, float64(time.Second))
+	}
+}
+
+func testReset(t *testing.T, b yarl.Backend) {
+	rb, ok := b.(yarl.ResetBackend)
+	if !ok {
+		t.Skip("backend does not implement yarl.ResetBackend")
+	}
+	ctx := context.Background()
+	k := key(t)
+
+	require.NoError(t, rb.Reset(ctx, k), "resetting a missing key is not an error")
+
+	for range 3 {
+		_, _, err := b.IncAndGetTTL(ctx, k, window)
+		require.NoError(t, err)
+	}
+	require.NoError(t, rb.Reset(ctx, k))
+
+	count, remaining, err := b.IncAndGetTTL(ctx, k, window)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.InDelta(t, window, remaining, float64(time.Second))
+}
+
+func testDecrement(t *testing.T, b yarl.Backend) {
+	rb, ok := b.(yarl.RefundBackend)
+	if !ok {
+		t.Skip("backend does not implement yarl.RefundBackend")
+	}
+	ctx := context.Background()
+	k := key(t)
+
+	require.NoError(t, rb.Decrement(ctx, k), "decrementing a missing key is not an error")
+
+	for range 2 {
+		_, _, err := b.IncAndGetTTL(ctx, k, window)
+		require.NoError(t, err)
+	}
+	for range 3 {
+		require.NoError(t, rb.Decrement(ctx, k))
+	}
+
+	count, remaining, err := b.IncAndGetTTL(ctx, k, window)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "counters must not go below 0")
+	assert.Greater(t, remaining, window-2*time.Second, "Decrement must keep the window")
+	assert.LessOrEqual(t, remaining, window)
+}
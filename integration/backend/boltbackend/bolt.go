@@ -0,0 +1,311 @@
+// Package boltbackend provides an embedded, file-backed YARL backend built on
+// bbolt, for single-binary deployments that must keep limits across restarts
+// without running Redis.
+//
+// Every operation runs in one bbolt transaction, so increments are atomic and
+// a batch either updates all of its counters or none. Counters whose window
+// has ended read as missing and are restarted on their next increment; their
+// space is reclaimed by [BoltBackend.Compact], usually run in the background
+// with [BoltBackend.RunCompaction].
+package boltbackend
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// countersBucket maps key → count (8 bytes) | window end in Unix nanoseconds (8 bytes).
+	countersBucket = []byte("yarl_counters")
+	// expiryBucket indexes counters by window end: Unix nanoseconds (8 bytes) | key → nil.
+	expiryBucket = []byte("yarl_expiry")
+)
+
+// compactChunk bounds the keys deleted per transaction, so that compaction
+// never holds the write lock for long.
+const compactChunk = 1000
+
+// BoltBackend is a rate-limit backend stored in a bbolt database.
+// Create one with [Open] or [New].
+type BoltBackend struct {
+	db    *bolt.DB
+	clock yarl.Clock
+}
+
+// Option configures a BoltBackend.
+type Option func(*BoltBackend)
+
+// WithClock makes the backend read the time from c instead of the system clock.
+func WithClock(c yarl.Clock) Option {
+	return func(b *BoltBackend) {
+		b.clock = c
+	}
+}
+
+// Open opens or creates the database file at path, with bbolt options boltOpts
+// (nil for the defaults), and returns a backend on it. [BoltBackend.Close]
+// closes the file.
+//
+// bbolt syncs the file on every commit. Where losing the last writes in a
+// power failure is acceptable, set NoSync in boltOpts for much faster increments.
+func Open(path string, boltOpts *bolt.Options, opts ...Option) (*BoltBackend, error) {
+	if boltOpts == nil {
+		boltOpts = &bolt.Options{Timeout: time.Second}
+	}
+	db, err := bolt.Open(path, 0o600, boltOpts)
+	if err != nil {
+		return nil, err
+	}
+	b, err := New(db, opts...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// New returns a backend on an open database, creating its buckets if needed.
+// The database may be shared with other buckets of the application.
+func New(db *bolt.DB, opts ...Option) (*BoltBackend, error) {
+	b := &BoltBackend{db: db, clock: yarl.SystemClock}
+	for _, opt := range opts {
+		opt(b)
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{countersBucket, expiryBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Close closes the underlying database.
+func (b *BoltBackend) Close() error {
+	return b.db.Close()
+}
+
+// IncAndGetTTL increments the counter for key, starting a new window of ttl if
+// the key is missing or its window has ended, and returns the new value and
+// remaining window duration.
+func (b *BoltBackend) IncAndGetTTL(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	now := b.clock.Now()
+	var count int64
+	var remaining time.Duration
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		count, remaining, err = inc(tx, key, ttl, now)
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, remaining, nil
+}
+
+// IncAndGetTTLBatch increments every entry in one transaction, so either all
+// counters change or none do. Implements [yarl.BatchBackend].
+func (b *BoltBackend) IncAndGetTTLBatch(ctx context.Context, entries []yarl.BatchEntry) ([]yarl.BatchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	now := b.clock.Now()
+	results := make([]yarl.BatchResult, len(entries))
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		for i, e := range entries {
+			count, remaining, err := inc(tx, e.Key, e.TTL, now)
+			if err != nil {
+				return err
+			}
+			results[i] = yarl.BatchResult{Count: count, Remaining: remaining}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func inc(tx *bolt.Tx, key string, ttl time.Duration, now time.Time) (int64, time.Duration, error) {
+	counters := tx.Bucket(countersBucket)
+	k := []byte(key)
+
+	count, expiresAt, ok := decode(counters.Get(k))
+	if ok && expiresAt.After(now) {
+		count++
+		if err := counters.Put(k, encode(count, expiresAt)); err != nil {
+			return 0, 0, err
+		}
+		return count, expiresAt.Sub(now), nil
+	}
+
+	expiry := tx.Bucket(expiryBucket)
+	if ok {
+		if err := expiry.Delete(expiryKey(expiresAt, k)); err != nil {
+			return 0, 0, err
+		}
+	}
+	expiresAt = now.Add(ttl)
+	if err := counters.Put(k, encode(1, expiresAt)); err != nil {
+		return 0, 0, err
+	}
+	if err := expiry.Put(expiryKey(expiresAt, k), nil); err != nil {
+		return 0, 0, err
+	}
+	return 1, ttl, nil
+}
+
+// Get returns the counter value and remaining window for key without
+// incrementing it. Missing and expired keys yield (0, 0, nil).
+// Implements [yarl.PeekBackend].
+func (b *BoltBackend) Get(ctx context.Context, key string) (int64, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	now := b.clock.Now()
+	var count int64
+	var remaining time.Duration
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c, expiresAt, ok := decode(tx.Bucket(countersBucket).Get([]byte(key)))
+		if ok && expiresAt.After(now) {
+			count, remaining = c, expiresAt.Sub(now)
+		}
+		return nil
+	})
+	return count, remaining, err
+}
+
+// Reset deletes the counter for key. Implements [yarl.ResetBackend].
+func (b *BoltBackend) Reset(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		counters := tx.Bucket(countersBucket)
+		k := []byte(key)
+		_, expiresAt, ok := decode(counters.Get(k))
+		if !ok {
+			return nil
+		}
+		if err := tx.Bucket(expiryBucket).Delete(expiryKey(expiresAt, k)); err != nil {
+			return err
+		}
+		return counters.Delete(k)
+	})
+}
+
+// Decrement lowers the counter for key by 1, keeping its window.
+// Implements [yarl.RefundBackend].
+func (b *BoltBackend) Decrement(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := b.clock.Now()
+	return b.db.Update(func(tx *bolt.Tx) error {
+		counters := tx.Bucket(countersBucket)
+		k := []byte(key)
+		count, expiresAt, ok := decode(counters.Get(k))
+		if !ok || !expiresAt.After(now) || count == 0 {
+			return nil
+		}
+		return counters.Put(k, encode(count-1, expiresAt))
+	})
+}
+
+// Compact deletes the counters whose window has ended and returns how many it
+// deleted. It walks the expiry index, so its cost follows the number of
+// expired counters, not the size of the database. bbolt reuses the freed pages
+// for new counters; the file itself does not shrink.
+func (b *BoltBackend) Compact(ctx context.Context) (int, error) {
+	end := expiryKey(b.clock.Now().Add(time.Nanosecond), nil) // windows ending now are over
+	total := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n := 0
+		err := b.db.Update(func(tx *bolt.Tx) error {
+			counters, expiry := tx.Bucket(countersBucket), tx.Bucket(expiryBucket)
+
+			// Collect first: deleting while iterating makes a bbolt cursor skip keys.
+			var expired [][]byte
+			c := expiry.Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0 && len(expired) < compactChunk; k, _ = c.Next() {
+				expired = append(expired, k)
+			}
+			for _, k := range expired {
+				if err := expiry.Delete(k); err != nil {
+					return err
+				}
+				if err := counters.Delete(k[8:]); err != nil {
+					return err
+				}
+			}
+			n = len(expired)
+			return nil
+		})
+		total += n
+		if err != nil || n < compactChunk {
+			return total, err
+		}
+	}
+}
+
+// RunCompaction calls [BoltBackend.Compact] every interval until ctx is done,
+// then returns ctx.Err(). Failed runs are passed to onError, which may be nil,
+// and retried at the next interval. Run it in its own goroutine:
+//
+//	go backend.RunCompaction(ctx, time.Minute, nil)
+func (b *BoltBackend) RunCompaction(ctx context.Context, interval time.Duration, onError func(error)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.clock.After(interval):
+		}
+		if _, err := b.Compact(ctx); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+	}
+}
+
+// encode packs a counter value.
+func encode(count int64, expiresAt time.Time) []byte {
+	v := make([]byte, 16)
+	binary.BigEndian.PutUint64(v, uint64(count))
+	binary.BigEndian.PutUint64(v[8:], uint64(expiresAt.UnixNano()))
+	return v
+}
+
+// decode unpacks a counter value; ok is false for missing or malformed values.
+func decode(v []byte) (count int64, expiresAt time.Time, ok bool) {
+	if len(v) != 16 {
+		return 0, time.Time{}, false
+	}
+	count = int64(binary.BigEndian.Uint64(v))
+	expiresAt = time.Unix(0, int64(binary.BigEndian.Uint64(v[8:])))
+	return count, expiresAt, true
+}
+
+// expiryKey builds the index key of a counter. Window ends are encoded big
+// endian so the index sorts by time; with a nil key it sorts before every
+// counter whose window ends at expiresAt or later.
+func expiryKey(expiresAt time.Time, key []byte) []byte {
+	k := make([]byte, 8, 8+len(key))
+	binary.BigEndian.PutUint64(k, uint64(expiresAt.UnixNano()))
+	return append(k, key...)
+}
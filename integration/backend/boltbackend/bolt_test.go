@@ -0,0 +1,157 @@
+package boltbackend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/integration/backend/backendtest"
+	"github.com/logocomune/yarl/v4/yarltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+// newBolt opens a BoltBackend on a fresh file, closed when the test ends.
+func newBolt(t *testing.T, opts ...Option) *BoltBackend {
+	t.Helper()
+	b, err := Open(filepath.Join(t.TempDir(), "yarl.db"), &bolt.Options{NoSync: true}, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// entries counts the keys of a bucket.
+func entries(t *testing.T, b *BoltBackend, bucket []byte) int {
+	t.Helper()
+	n := 0
+	require.NoError(t, b.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(bucket).Stats().KeyN
+		return nil
+	}))
+	return n
+}
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) yarl.Backend {
+		return newBolt(t)
+	})
+}
+
+func TestBoltBackend_PersistsAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "yarl.db")
+
+	b, err := Open(path, nil)
+	require.NoError(t, err)
+	b.IncAndGetTTL(ctx, "r:alice", time.Hour)
+	b.IncAndGetTTL(ctx, "r:alice", time.Hour)
+	require.NoError(t, b.Close())
+
+	b, err = Open(path, nil)
+	require.NoError(t, err)
+	defer b.Close()
+	count, remaining, err := b.IncAndGetTTL(ctx, "r:alice", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+	assert.Greater(t, remaining, 59*time.Minute)
+}
+
+func TestBoltBackend_WindowRestart(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	b := newBolt(t, WithClock(clock))
+
+	b.IncAndGetTTL(ctx, "r:alice", time.Minute)
+	clock.Advance(45 * time.Second)
+	count, remaining, err := b.IncAndGetTTL(ctx, "r:alice", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, 15*time.Second, remaining)
+
+	clock.Advance(15 * time.Second)
+	count, _, err = b.Get(ctx, "r:alice")
+	require.NoError(t, err)
+	assert.Zero(t, count, "an ended window reads as missing")
+
+	count, remaining, err = b.IncAndGetTTL(ctx, "r:alice", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, time.Minute, remaining)
+	assert.Equal(t, 1, entries(t, b, expiryBucket), "the old window must leave the expiry index")
+}
+
+func TestBoltBackend_BatchIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	b := newBolt(t)
+
+	_, err := b.IncAndGetTTLBatch(ctx, []yarl.BatchEntry{
+		{Key: "a:alice", TTL: time.Minute},
+		{Key: "", TTL: time.Minute}, // bbolt rejects empty keys
+	})
+	require.Error(t, err)
+
+	count, _, err := b.Get(ctx, "a:alice")
+	require.NoError(t, err)
+	assert.Zero(t, count, "a failed batch must roll back every increment")
+}
+
+func TestBoltBackend_Reset(t *testing.T) {
+	ctx := context.Background()
+	b := newBolt(t)
+
+	b.IncAndGetTTL(ctx, "r:alice", time.Minute)
+	require.NoError(t, b.Reset(ctx, "r:alice"))
+	require.NoError(t, b.Reset(ctx, "r:missing"))
+	assert.Zero(t, entries(t, b, countersBucket))
+	assert.Zero(t, entries(t, b, expiryBucket))
+}
+
+func TestBoltBackend_Compact(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	b := newBolt(t, WithClock(clock))
+
+	for i := range compactChunk + 10 {
+		_, _, err := b.IncAndGetTTL(ctx, fmt.Sprintf("r:user-%d", i), time.Second)
+		require.NoError(t, err)
+	}
+	b.IncAndGetTTL(ctx, "r:long", time.Hour)
+	clock.Advance(time.Second)
+
+	n, err := b.Compact(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, compactChunk+10, n, "compaction must continue past one chunk")
+	assert.Equal(t, 1, entries(t, b, countersBucket))
+	assert.Equal(t, 1, entries(t, b, expiryBucket))
+
+	count, _, err := b.Get(ctx, "r:long")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestBoltBackend_RunCompaction(t *testing.T) {
+	clock := yarltest.NewClock(time.Time{})
+	b := newBolt(t, WithClock(clock))
+	b.IncAndGetTTL(context.Background(), "r:short", time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var failures atomic.Int32
+	done := make(chan error)
+	go func() {
+		done <- b.RunCompaction(ctx, time.Minute, func(error) { failures.Add(1) })
+	}()
+
+	require.Eventually(t, func() bool { return clock.Waiters() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(time.Minute)
+	require.Eventually(t, func() bool { return entries(t, b, countersBucket) == 0 }, time.Second, time.Millisecond)
+
+	cancel()
+	assert.True(t, errors.Is(<-done, context.Canceled))
+	assert.Zero(t, failures.Load())
+}
@@ -0,0 +1,135 @@
+package lrubackend
+
+import (
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// entryOverhead estimates the bytes a counter takes besides its user key: the
+// cache's map slot, list element and expiry bucket, plus the entry itself.
+const entryOverhead = 192
+
+// entrySize estimates the bytes the counter of userKey takes in a cache.
+func entrySize(userKey string) int64 {
+	return int64(len(userKey)) + entryOverhead
+}
+
+// WithMemoryBudget caps the estimated memory of all counters, across every
+// rule, at bytes. When adding a key would exceed it, the least recently used
+// counter of the largest cache is evicted, so a flood of keys on one rule ends
+// up evicting its own counters rather than starving the other rules. The
+// estimate covers the user keys and the caches' bookkeeping, not leases.
+// sizePerRule still applies; pass 0 to rely on the budget alone.
+func WithMemoryBudget(bytes int64) Option {
+	return func(l *LRUBackend) {
+		l.budget = bytes
+	}
+}
+
+// WithRejectWhenFull makes a full backend deny new keys instead of evicting
+// live counters. Eviction resets a user's window, so a flood of distinct keys
+// would otherwise let the evicted users through; with this option a new key
+// arriving while the caches are saturated is reported as over every rule's
+// limit, with a retry after the full window, and is not stored: its count is
+// [yarl.Saturated]. Expired counters are still dropped to make room.
+func WithRejectWhenFull() Option {
+	return func(l *LRUBackend) {
+		l.rejectFull = true
+	}
+}
+
+// WithOnEvict calls fn with the rule ID of every live counter evicted to make
+// room, e.g. to count evictions per rule in a metric. fn runs with the
+// backend's lock held: it must be fast and must not call the backend.
+func WithOnEvict(fn func(ruleID string)) Option {
+	return func(l *LRUBackend) {
+		l.onEvict = fn
+	}
+}
+
+// store adds e as the counter of userKey, replacing any counter the key holds
+// under the rule, and makes room for it first. It reports false and stores
+// nothing if the backend is saturated and rejects new keys.
+// Callers must hold l.mu.
+func (l *LRUBackend) store(ruleID, userKey string, e *entry, now time.Time) bool {
+	cache := l.cache(ruleID)
+	cache.Remove(userKey) // keeps the byte count exact when the key is re-added
+	size := entrySize(userKey)
+
+	// The caches do not purge on their own: drop the expired counters at the
+	// least recently used end, each at most once, so idle keys do not pile up.
+	for {
+		_, oldest, ok := cache.GetOldest()
+		if !ok || oldest.expiresAt.After(now) {
+			break
+		}
+		cache.RemoveOldest()
+	}
+
+	if l.sizePerRule > 0 && cache.Len() >= l.sizePerRule && !l.dropOldest(ruleID, cache, now) {
+		l.rejections++
+		return false
+	}
+	for l.budget > 0 && l.bytes.Load()+size > l.budget {
+		victimID, victim := l.largest(ruleID, cache)
+		if victim == nil || !l.dropOldest(victimID, victim, now) {
+			l.rejections++
+			return false
+		}
+	}
+
+	cache.Add(userKey, e)
+	l.bytes.Add(size)
+	return true
+}
+
+// dropOldest removes the least recently used counter of cache if it has
+// expired, or evicts it unless the backend rejects new keys when full. It
+// reports whether a counter was removed. Callers must hold l.mu.
+func (l *LRUBackend) dropOldest(ruleID string, cache *expirable.LRU[string, *entry], now time.Time) bool {
+	_, e, ok := cache.GetOldest()
+	if !ok {
+		return false
+	}
+	live := e.expiresAt.After(now)
+	if live && l.rejectFull {
+		return false
+	}
+	cache.RemoveOldest()
+	if live {
+		l.evictions++
+		if l.onEvict != nil {
+			l.onEvict(ruleID)
+		}
+	}
+	return true
+}
+
+// largest returns the cache holding the most counters, preferring own on ties,
+// or nil if all are empty. Callers must hold l.mu.
+func (l *LRUBackend) largest(ruleID string, own *expirable.LRU[string, *entry]) (string, *expirable.LRU[string, *entry]) {
+	var best *expirable.LRU[string, *entry]
+	if own.Len() > 0 {
+		best = own
+	}
+	for id, cache := range l.lrus {
+		if cache.Len() > 0 && (best == nil || cache.Len() > best.Len()) {
+			ruleID, best = id, cache
+		}
+	}
+	return ruleID, best
+}
+
+// Bytes returns the estimated memory held by the counters.
+func (l *LRUBackend) Bytes() int64 {
+	return l.bytes.Load()
+}
+
+// Rejections returns how many new keys were denied because the backend was
+// full. It only grows with [WithRejectWhenFull].
+func (l *LRUBackend) Rejections() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rejections
+}
@@ -0,0 +1,132 @@
+package lrubackend
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/yarltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUBackend_MemoryBudget(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	b := New(nil, 0, WithMemoryBudget(3*entrySize("user-0")), WithOnEvict(func(ruleID string) {
+		evicted = append(evicted, ruleID)
+	}))
+
+	for i := range 3 {
+		b.IncAndGetTTL(ctx, fmt.Sprintf("a:user-%d", i), time.Minute)
+	}
+	assert.Equal(t, 3*entrySize("user-0"), b.Bytes())
+	assert.Empty(t, evicted)
+
+	// The largest cache gives up its least recently used counter.
+	b.IncAndGetTTL(ctx, "b:user-0", time.Minute)
+	assert.Equal(t, []string{"a"}, evicted)
+	count, _, _ := b.Get(ctx, "a:user-0")
+	assert.Zero(t, count)
+
+	// Once the caches are even, a flooded rule evicts its own counters.
+	b.IncAndGetTTL(ctx, "b:user-1", time.Minute)
+	b.IncAndGetTTL(ctx, "b:user-2", time.Minute)
+	assert.Equal(t, []string{"a", "a", "b"}, evicted)
+	assert.Equal(t, 3, b.Len())
+	assert.Equal(t, uint64(3), b.Evictions())
+	assert.LessOrEqual(t, b.Bytes(), 3*entrySize("user-0"))
+}
+
+func TestLRUBackend_BytesFollowRemovals(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	b := New(nil, 100, WithClock(clock))
+
+	b.IncAndGetTTL(ctx, "r1:alice", time.Minute)
+	b.IncAndGetTTL(ctx, "r1:alice", time.Minute)
+	b.IncAndGetTTL(ctx, "r1:bob", time.Minute)
+	assert.Equal(t, entrySize("alice")+entrySize("bob"), b.Bytes())
+
+	require.NoError(t, b.Reset(ctx, "r1:alice"))
+	assert.Equal(t, entrySize("bob"), b.Bytes())
+
+	clock.Advance(time.Minute)
+	b.IncAndGetTTL(ctx, "r1:bob", time.Minute)
+	assert.Equal(t, entrySize("bob"), b.Bytes(), "a new window must not count the key twice")
+}
+
+func TestLRUBackend_RejectWhenFull(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	b := New(nil, 2, WithClock(clock), WithRejectWhenFull())
+
+	b.IncAndGetTTL(ctx, "r1:user2", time.Minute)
+	clock.Advance(30 * time.Second)
+	b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+
+	count, remaining, err := b.IncAndGetTTL(ctx, "r1:user3", time.Minute)
+	require.NoError(t, err)
+	assert.Greater(t, count, int64(1_000_000), "a rejected key must exceed any limit")
+	assert.Equal(t, time.Minute, remaining)
+	assert.Equal(t, uint64(1), b.Rejections())
+	assert.Zero(t, b.Evictions())
+
+	count, _, _ = b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+	assert.Equal(t, int64(2), count, "known keys keep counting")
+
+	clock.Advance(30 * time.Second)
+	count, _, _ = b.IncAndGetTTL(ctx, "r1:user3", time.Minute)
+	assert.Equal(t, int64(1), count, "expired counters still make room")
+	assert.Zero(t, b.Evictions())
+}
+
+func TestLRUBackend_RejectWhenFull_Budget(t *testing.T) {
+	ctx := context.Background()
+	b := New([]yarl.Rule{{ID: "r", TTL: time.Minute, MaxRequests: 5}}, 0,
+		WithMemoryBudget(entrySize("user-0")), WithRejectWhenFull())
+	l := yarl.New(b, yarl.Rule{ID: "r", TTL: time.Minute, MaxRequests: 5})
+
+	results, err := l.Check(ctx, "user-0")
+	require.NoError(t, err)
+	yarltest.RequireAllowed(t, results)
+
+	results, err = l.Check(ctx, "user-1")
+	require.NoError(t, err)
+	yarltest.RequireDenied(t, results, "r")
+	assert.Equal(t, time.Minute, results[0].RetryAfter)
+	assert.Equal(t, 1, b.Len())
+}
+
+func TestLRUBackend_RejectWhenFull_BanPolicy(t *testing.T) {
+	ctx := context.Background()
+	rule := yarl.Rule{ID: "r", TTL: time.Minute, MaxRequests: 1}
+	// Room for two counters of five-byte user keys, ban state included.
+	b := New(nil, 0, WithMemoryBudget(2*entrySize("alice")), WithRejectWhenFull())
+	l := yarl.NewWithOptions(b, []yarl.Rule{rule},
+		yarl.WithBanPolicy(yarl.BanPolicy{Period: time.Minute, Duration: time.Minute}))
+
+	for _, key := range []string{"alice", "bobby"} {
+		results, err := l.Check(ctx, key)
+		require.NoError(t, err)
+		yarltest.RequireAllowed(t, results)
+	}
+
+	// A key refused by the full backend is denied, but is no violation: it is
+	// neither banned nor charged with ban state.
+	results, err := l.Check(ctx, "carol")
+	require.NoError(t, err)
+	yarltest.RequireDenied(t, results, "r")
+	assert.False(t, results[0].Banned)
+
+	// A real violation whose ban state cannot be stored fails instead of
+	// reporting a ban that would never be enforced.
+	_, err = l.Check(ctx, "alice")
+	assert.ErrorIs(t, err, yarl.ErrBackendFull)
+	assert.Equal(t, 2, b.Len())
+	count, _, err := b.Get(ctx, "ban.ban:alice")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,14 @@
+package lrubackend
+
+import (
+	"testing"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/integration/backend/backendtest"
+)
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) yarl.Backend {
+		return New(nil, 1000)
+	})
+}
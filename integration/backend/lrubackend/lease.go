@@ -0,0 +1,63 @@
+package lrubackend
+
+import (
+	"context"
+	"time"
+)
+
+// Acquire drops the expired leases of key and adds leaseID if fewer than max
+// remain. Implements [yarl.LeaseBackend].
+//
+// Leases are kept in a plain map outside the LRU caches: a held slot must never
+// be evicted, and the map only holds keys with at least one live lease.
+func (l *LRUBackend) Acquire(ctx context.Context, key, leaseID string, max int64, ttl time.Duration) (bool, int64, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return false, 0, 0, err
+	}
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	held := l.leases[key]
+	for id, expiresAt := range held {
+		if !expiresAt.After(now) {
+			delete(held, id)
+		}
+	}
+
+	acquired := int64(len(held)) < max
+	if acquired {
+		if held == nil {
+			held = make(map[string]time.Time)
+			l.leases[key] = held
+		}
+		held[leaseID] = now.Add(ttl)
+	}
+	if len(held) == 0 {
+		delete(l.leases, key)
+		return acquired, 0, 0, nil
+	}
+
+	var oldest time.Time
+	for _, expiresAt := range held {
+		if oldest.IsZero() || expiresAt.Before(oldest) {
+			oldest = expiresAt
+		}
+	}
+	return acquired, int64(len(held)), oldest.Sub(now), nil
+}
+
+// Release removes leaseID from key. Implements [yarl.LeaseBackend].
+func (l *LRUBackend) Release(_ context.Context, key, leaseID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if held, ok := l.leases[key]; ok {
+		delete(held, leaseID)
+		if len(held) == 0 {
+			delete(l.leases, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package lrubackend
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUBackend_Acquire(t *testing.T) {
+	ctx := context.Background()
+	b := New(nil, 100)
+
+	ok, held, oldest, err := b.Acquire(ctx, "c:u", "l1", 2, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), held)
+	assert.InDelta(t, time.Minute.Seconds(), oldest.Seconds(), 1)
+
+	ok, held, _, _ = b.Acquire(ctx, "c:u", "l2", 2, time.Minute)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), held)
+
+	ok, held, oldest, _ = b.Acquire(ctx, "c:u", "l3", 2, time.Minute)
+	assert.False(t, ok)
+	assert.Equal(t, int64(2), held)
+	assert.Greater(t, oldest, time.Duration(0))
+
+	ok, _, _, _ = b.Acquire(ctx, "c:other", "l4", 2, time.Minute)
+	assert.True(t, ok, "keys must have independent slots")
+}
+
+func TestLRUBackend_Release(t *testing.T) {
+	ctx := context.Background()
+	b := New(nil, 100)
+
+	b.Acquire(ctx, "c:u", "l1", 1, time.Minute)
+	require.NoError(t, b.Release(ctx, "c:u", "l1"))
+	require.NoError(t, b.Release(ctx, "c:u", "unknown"))
+	assert.Empty(t, b.leases, "keys without leases must not be retained")
+
+	ok, _, _, _ := b.Acquire(ctx, "c:u", "l2", 1, time.Minute)
+	assert.True(t, ok)
+}
+
+func TestLRUBackend_Acquire_ExpiredLeasesFreeSlots(t *testing.T) {
+	ctx := context.Background()
+	b := New(nil, 100)
+
+	ok, _, _, _ := b.Acquire(ctx, "c:u", "crashed", 1, 50*time.Millisecond)
+	require.True(t, ok)
+	ok, _, _, _ = b.Acquire(ctx, "c:u", "l2", 1, time.Minute)
+	require.False(t, ok)
+
+	time.Sleep(80 * time.Millisecond)
+
+	ok, held, _, _ := b.Acquire(ctx, "c:u", "l2", 1, time.Minute)
+	assert.True(t, ok, "an unreleased lease must stop counting after its TTL")
+	assert.Equal(t, int64(1), held)
+}
+
+func TestLRUBackend_Acquire_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	b := New(nil, 100)
+
+	var granted atomic.Int64
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Go(func() {
+			ok, _, _, err := b.Acquire(ctx, "c:u", string(rune('a'+i)), 10, time.Minute)
+			assert.NoError(t, err)
+			if ok {
+				granted.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, int64(10), granted.Load())
+}
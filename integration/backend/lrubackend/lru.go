@@ -1,60 +1,168 @@
 // Package lrubackend provides an in-memory LRU backend for YARL with per-entry TTL.
 //
-// Because [expirable.LRU] is constructed with a single global TTL, one LRU
-// instance is created per [yarl.Rule]. Rules with different window durations
-// therefore each get their own correctly-configured cache.
+// One [expirable.LRU] is created per rule ID, on the first call that uses it,
+// so rules not known in advance, such as tiered rules or the ban keys of a
+// [yarl.BanPolicy], work without configuration. Every entry keeps its own
+// window and expiry, so the ttl passed to [LRUBackend.IncAndGetTTL] is always
+// honored. The caches are built without a TTL and therefore run no purge
+// goroutine: an expired counter is replaced on its key's next use, dropped
+// from the least recently used end of its cache when a new key is stored, or
+// evicted first when the cache is full.
 package lrubackend
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/golang-lru/v2/expirable"
 	yarl "github.com/logocomune/yarl/v4"
 )
 
+// ErrInvalidKey is returned for keys without the "{ruleID}:{userKey}" format.
+var ErrInvalidKey = errors.New("lrubackend: key must have the format {ruleID}:{userKey}")
+
 type entry struct {
 	count     int64
+	window    time.Duration // ttl the window was opened with
 	expiresAt time.Time
 }
 
 // LRUBackend is a thread-safe in-memory rate-limit backend.
 // Create one with [New].
 type LRUBackend struct {
-	mu   sync.Mutex
-	lrus map[string]*expirable.LRU[string, *entry]
+	mu          sync.Mutex
+	clock       yarl.Clock
+	sizePerRule int
+	lrus        map[string]*expirable.LRU[string, *entry] // ruleID → cache
+	leases      map[string]map[string]time.Time           // key → leaseID → expiry
+
+	budget     int64               // maximum estimated bytes across all caches; 0 = no limit
+	rejectFull bool                // deny new keys instead of evicting live counters
+	onEvict    func(ruleID string) // called for every evicted live counter
+	bytes      atomic.Int64        // estimated bytes held; read by Bytes without the lock
+	evictions  uint64              // live entries dropped because a cache was full
+	rejections uint64              // new keys denied because the caches were full
+}
+
+// Option configures an LRUBackend created with [New].
+type Option func(*LRUBackend)
+
+// WithClock makes the backend read the time from c instead of the system clock,
+// so windows expire when a fake clock such as yarltest.Clock is advanced.
+func WithClock(c yarl.Clock) Option {
+	return func(l *LRUBackend) {
+		l.clock = c
+	}
 }
 
 // New creates an LRUBackend.
-// rules must match those passed to [yarl.New] so that one [expirable.LRU] is
-// pre-created per rule with the correct TTL.
+// rules may be nil; the caches of the given rules are created up front instead
+// of on their first request.
 // sizePerRule is the maximum number of distinct user keys tracked per rule;
 // total memory is roughly numRules × sizePerRule × entrySize.
-func New(rules []yarl.Rule, sizePerRule int) *LRUBackend {
-	lrus := make(map[string]*expirable.LRU[string, *entry], len(rules))
+func New(rules []yarl.Rule, sizePerRule int, opts ...Option) *LRUBackend {
+	l := &LRUBackend{
+		clock:       yarl.SystemClock,
+		sizePerRule: sizePerRule,
+		lrus:        make(map[string]*expirable.LRU[string, *entry], len(rules)),
+		leases:      make(map[string]map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
 	for _, r := range rules {
-		lrus[r.ID] = expirable.NewLRU[string, *entry](sizePerRule, nil, r.TTL)
+		l.cache(r.ID)
+	}
+	return l
+}
+
+// cache returns the LRU of ruleID, creating it on first use.
+// Callers must hold l.mu, except in [New].
+func (l *LRUBackend) cache(ruleID string) *expirable.LRU[string, *entry] {
+	cache, ok := l.lrus[ruleID]
+	if !ok {
+		// A zero TTL disables the cache's own expiry and its purge goroutine,
+		// which would never exit; entries expire by their expiresAt instead.
+		cache = expirable.NewLRU(l.sizePerRule, func(userKey string, _ *entry) {
+			l.bytes.Add(-entrySize(userKey))
+		}, 0)
+		l.lrus[ruleID] = cache
 	}
-	return &LRUBackend{lrus: lrus}
+	return cache
+}
+
+// lookup returns the live entry of userKey under ruleID without updating its
+// recency. Callers must hold l.mu.
+func (l *LRUBackend) lookup(ruleID, userKey string, now time.Time) (*entry, bool) {
+	e, ok := l.cache(ruleID).Peek(userKey)
+	if !ok || !e.expiresAt.After(now) {
+		return nil, false
+	}
+	return e, true
 }
 
 // IncAndGetTTL increments the counter for key and returns the new value and
 // remaining window duration. key must have the format "{ruleID}:{userKey}".
-func (l *LRUBackend) IncAndGetTTL(_ context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
-	ruleID, userKey := splitKey(key)
-	now := time.Now()
+func (l *LRUBackend) IncAndGetTTL(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	ruleID, userKey, err := parseKey(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	now := l.clock.Now()
 
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	cache := l.lrus[ruleID]
+	return l.inc(ruleID, userKey, ttl, now)
+}
 
-	e, ok := cache.Get(userKey)
-	if !ok {
-		e = &entry{count: 1, expiresAt: now.Add(ttl)}
-		cache.Add(userKey, e)
+// IncAndGetTTLBatch increments every entry under a single lock acquisition, so
+// the counters of one [yarl.Limiter.Check] form a consistent snapshot that no
+// concurrent request interleaves with. No counter changes if a key is invalid.
+// Implements [yarl.BatchBackend].
+func (l *LRUBackend) IncAndGetTTLBatch(ctx context.Context, entries []yarl.BatchEntry) ([]yarl.BatchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type parsed struct{ ruleID, userKey string }
+	keys := make([]parsed, len(entries))
+	for i, e := range entries {
+		ruleID, userKey, err := parseKey(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = parsed{ruleID, userKey}
+	}
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	results := make([]yarl.BatchResult, len(entries))
+	for i, e := range entries {
+		count, remaining, _ := l.inc(keys[i].ruleID, keys[i].userKey, e.TTL, now)
+		results[i] = yarl.BatchResult{Count: count, Remaining: remaining}
+	}
+	return results, nil
+}
+
+// inc increments the counter of userKey in the cache of ruleID. A counter
+// whose window has expired or was opened with another ttl is replaced by a new
+// window. A new key the saturated backend rejects gets a count of
+// [yarl.Saturated], which violates every rule. Callers must hold l.mu.
+func (l *LRUBackend) inc(ruleID, userKey string, ttl time.Duration, now time.Time) (int64, time.Duration, error) {
+	e, ok := l.cache(ruleID).Get(userKey)
+	if !ok || !e.expiresAt.After(now) || e.window != ttl {
+		if !l.store(ruleID, userKey, &entry{count: 1, window: ttl, expiresAt: now.Add(ttl)}, now) {
+			return yarl.Saturated, ttl, nil
+		}
 		return 1, ttl, nil
 	}
 
@@ -62,6 +170,99 @@ func (l *LRUBackend) IncAndGetTTL(_ context.Context, key string, ttl time.Durati
 	return e.count, e.expiresAt.Sub(now), nil
 }
 
+// Get returns the counter value and remaining window for key without
+// incrementing it. Missing and expired keys yield (0, 0, nil).
+// Implements [yarl.PeekBackend].
+func (l *LRUBackend) Get(ctx context.Context, key string) (int64, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	ruleID, userKey, err := parseKey(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.lookup(ruleID, userKey, now)
+	if !ok {
+		return 0, 0, nil
+	}
+	return e.count, e.expiresAt.Sub(now), nil
+}
+
+// Reset deletes the counter for key. Implements [yarl.ResetBackend].
+func (l *LRUBackend) Reset(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ruleID, userKey, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cache(ruleID).Remove(userKey)
+	return nil
+}
+
+// Decrement lowers the counter for key by 1, keeping its window.
+// Implements [yarl.RefundBackend].
+func (l *LRUBackend) Decrement(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ruleID, userKey, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.lookup(ruleID, userKey, now); ok && e.count > 0 {
+		e.count--
+	}
+	return nil
+}
+
+// Len returns the number of counters held across all rules, including expired
+// counters not yet dropped.
+func (l *LRUBackend) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := 0
+	for _, cache := range l.lrus {
+		n += cache.Len()
+	}
+	return n
+}
+
+// Evictions returns how many live counters were dropped because their rule's
+// cache was full or the memory budget was reached. An evicted user starts a
+// fresh window on its next request, so a growing value means sizePerRule or the
+// budget is too small for the traffic.
+func (l *LRUBackend) Evictions() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.evictions
+}
+
+// parseKey splits key like [splitKey] and returns [ErrInvalidKey] if it has no colon.
+func parseKey(key string) (ruleID, userKey string, err error) {
+	if !strings.Contains(key, ":") {
+		return "", "", ErrInvalidKey
+	}
+	ruleID, userKey = splitKey(key)
+	return ruleID, userKey, nil
+}
+
 // splitKey splits "{ruleID}:{userKey}" on the first colon.
 func splitKey(key string) (ruleID, userKey string) {
 	ruleID, userKey, _ = strings.Cut(key, ":")
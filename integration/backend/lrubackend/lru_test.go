@@ -2,6 +2,8 @@ package lrubackend
 
 import (
 	"context"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -9,6 +11,7 @@ import (
 	"time"
 
 	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/yarltest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -117,6 +120,195 @@ func TestLRUBackend_IncAndGetTTL_MultipleRulesDifferentTTLs(t *testing.T) {
 	assert.Equal(t, int64(2), slowCount, "slow rule must keep its counter across fast window boundaries")
 }
 
+func TestLRUBackend_UnknownPrefix(t *testing.T) {
+	ctx := context.Background()
+	b := New(rules(time.Minute), 100)
+
+	count, remaining, err := b.IncAndGetTTL(ctx, "ban:user1", 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, 50*time.Millisecond, remaining)
+
+	// The lazily created cache has no global TTL; each entry keeps its own.
+	_, _, err = b.IncAndGetTTL(ctx, "ban:user2", time.Hour)
+	require.NoError(t, err)
+
+	time.Sleep(80 * time.Millisecond)
+
+	count, _, err = b.Get(ctx, "ban:user1")
+	require.NoError(t, err)
+	assert.Zero(t, count, "expired entries must read as missing")
+	count, _, err = b.Get(ctx, "ban:user2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	count, remaining, err = b.IncAndGetTTL(ctx, "ban:user1", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "expired entries must restart")
+	assert.Equal(t, time.Second, remaining)
+}
+
+func TestLRUBackend_HonorsPerCallTTL(t *testing.T) {
+	ctx := context.Background()
+	b := New(rules(50*time.Millisecond), 100)
+
+	// A window longer than the rule's configured TTL must outlive it.
+	_, remaining, err := b.IncAndGetTTL(ctx, "r1:user1", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, remaining)
+
+	time.Sleep(80 * time.Millisecond)
+
+	count, remaining, err := b.IncAndGetTTL(ctx, "r1:user1", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count, "the cache must not purge entries before their own TTL")
+	assert.Greater(t, remaining, 59*time.Minute)
+}
+
+func TestLRUBackend_TTLChangeStartsNewWindow(t *testing.T) {
+	ctx := context.Background()
+	b := New(nil, 100)
+
+	b.IncAndGetTTL(ctx, "tier:user1", time.Minute)
+	b.IncAndGetTTL(ctx, "tier:user1", time.Minute)
+
+	count, remaining, err := b.IncAndGetTTL(ctx, "tier:user1", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, time.Hour, remaining)
+
+	count, remaining, err = b.Get(ctx, "tier:user1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "the old window must be dropped")
+	assert.Greater(t, remaining, 59*time.Minute)
+	assert.Equal(t, 1, b.Len())
+
+	require.NoError(t, b.Reset(ctx, "tier:user1"))
+	assert.Zero(t, b.Len())
+}
+
+func TestLRUBackend_DistinctTTLsStartNoGoroutines(t *testing.T) {
+	ctx := context.Background()
+	before := runtime.NumGoroutine()
+	b := New(nil, 100)
+
+	for i := range 1000 {
+		_, _, err := b.IncAndGetTTL(ctx, "tier:user"+strconv.Itoa(i), time.Duration(i+1)*time.Second)
+		require.NoError(t, err)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+	assert.Len(t, b.lrus, 1)
+}
+
+func TestLRUBackend_DropsExpiredOnStore(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	b := New(nil, 0, WithClock(clock))
+
+	for i := range 10 {
+		b.IncAndGetTTL(ctx, "r1:user"+strconv.Itoa(i), time.Minute)
+	}
+	clock.Advance(time.Minute)
+	b.IncAndGetTTL(ctx, "r1:new", time.Minute)
+
+	assert.Equal(t, 1, b.Len())
+	assert.Equal(t, entrySize("new"), b.Bytes())
+	assert.Zero(t, b.Evictions(), "expired counters are not evictions")
+}
+
+func TestLRUBackend_InvalidKey(t *testing.T) {
+	ctx := context.Background()
+	b := New(rules(time.Minute), 100)
+
+	_, _, err := b.IncAndGetTTL(ctx, "nocolon", time.Minute)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, _, err = b.Get(ctx, "nocolon")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	assert.ErrorIs(t, b.Reset(ctx, "nocolon"), ErrInvalidKey)
+	assert.Zero(t, b.Len())
+}
+
+func TestLRUBackend_WithClock(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	b := New(rules(time.Minute), 100, WithClock(clock))
+
+	_, remaining, err := b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, remaining)
+
+	clock.Advance(45 * time.Second)
+	count, remaining, err := b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, 15*time.Second, remaining)
+
+	clock.Advance(15 * time.Second)
+	count, _, err = b.Get(ctx, "r1:user1")
+	require.NoError(t, err)
+	assert.Zero(t, count, "the window must expire on the fake clock")
+
+	count, remaining, err = b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, time.Minute, remaining)
+}
+
+func TestLRUBackend_Get(t *testing.T) {
+	ctx := context.Background()
+	b := New(rules(time.Minute), 100)
+
+	count, rem, err := b.Get(ctx, "r1:user1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+	assert.Equal(t, time.Duration(0), rem)
+
+	b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+	b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+
+	count, rem, err = b.Get(ctx, "r1:user1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Greater(t, rem, 59*time.Second)
+
+	count, _, _ = b.Get(ctx, "r1:user1")
+	assert.Equal(t, int64(2), count, "Get must not increment")
+
+	count, _, err = b.Get(ctx, "unknown:user1")
+	require.NoError(t, err, "unknown rules must not panic")
+	assert.Equal(t, int64(0), count)
+}
+
+func TestLRUBackend_Reset(t *testing.T) {
+	ctx := context.Background()
+	b := New(rules(time.Minute), 100)
+
+	b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+	b.IncAndGetTTL(ctx, "r1:user2", time.Minute)
+	require.NoError(t, b.Reset(ctx, "r1:user1"))
+	require.NoError(t, b.Reset(ctx, "unknown:user1"))
+
+	count, _, _ := b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+	assert.Equal(t, int64(1), count, "counter must restart after Reset")
+	count, _, _ = b.Get(ctx, "r1:user2")
+	assert.Equal(t, int64(1), count, "other keys must be untouched")
+}
+
+func TestLRUBackend_LenAndEvictions(t *testing.T) {
+	ctx := context.Background()
+	b := New(rules(time.Minute), 2)
+
+	b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+	b.IncAndGetTTL(ctx, "r1:user2", time.Minute)
+	b.IncAndGetTTL(ctx, "r1:user2", time.Minute)
+	assert.Equal(t, 2, b.Len())
+	assert.Equal(t, uint64(0), b.Evictions())
+
+	b.IncAndGetTTL(ctx, "r1:user3", time.Minute)
+	assert.Equal(t, 2, b.Len())
+	assert.Equal(t, uint64(1), b.Evictions(), "adding a third user to a full cache evicts one")
+}
+
 func TestSplitKey(t *testing.T) {
 	tests := []struct {
 		key         string
@@ -173,3 +365,39 @@ func FuzzSplitKey(f *testing.F) {
 		}
 	})
 }
+
+func TestLRUBackend_IncAndGetTTLBatch(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	b := New(nil, 100, WithClock(clock))
+
+	entries := []yarl.BatchEntry{
+		{Key: "burst:user1", TTL: time.Second},
+		{Key: "daily:user1", TTL: 24 * time.Hour},
+	}
+	_, err := b.IncAndGetTTLBatch(ctx, entries)
+	require.NoError(t, err)
+
+	clock.Advance(500 * time.Millisecond)
+	results, err := b.IncAndGetTTLBatch(ctx, entries)
+	require.NoError(t, err)
+	assert.Equal(t, []yarl.BatchResult{
+		{Count: 2, Remaining: 500 * time.Millisecond},
+		{Count: 2, Remaining: 24*time.Hour - 500*time.Millisecond},
+	}, results)
+
+	count, _, err := b.IncAndGetTTL(ctx, "daily:user1", 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count, "batch and single calls share counters")
+}
+
+func TestLRUBackend_IncAndGetTTLBatch_InvalidKey(t *testing.T) {
+	b := New(nil, 100)
+
+	_, err := b.IncAndGetTTLBatch(context.Background(), []yarl.BatchEntry{
+		{Key: "r1:user1", TTL: time.Minute},
+		{Key: "nocolon", TTL: time.Minute},
+	})
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	assert.Zero(t, b.Len(), "no counter may change when a key is invalid")
+}
@@ -0,0 +1,160 @@
+package lrubackend
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Record is one counter in a snapshot. Snapshots are JSON Lines, one Record
+// per line, so the snapshots of several backends can be concatenated.
+type Record struct {
+	Key       string        `json:"key"`        // "{ruleID}:{userKey}"
+	Window    time.Duration `json:"window"`     // ttl of the window, in nanoseconds
+	Count     int64         `json:"count"`      // requests counted in the window
+	ExpiresAt time.Time     `json:"expires_at"` // absolute end of the window
+}
+
+// Snapshot writes the live counters to w, least recently used first, so that
+// [LRUBackend.Restore] rebuilds the same eviction order. Leases are not
+// included: the requests holding them do not survive a restart.
+//
+// The lock is only held while the counters are copied, not while writing to w.
+func (l *LRUBackend) Snapshot(w io.Writer) error {
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	var records []Record
+	for ruleID, cache := range l.lrus {
+		for _, userKey := range cache.Keys() {
+			if e, ok := cache.Peek(userKey); ok && e.expiresAt.After(now) {
+				records = append(records, Record{
+					Key:       ruleID + ":" + userKey,
+					Window:    e.window,
+					Count:     e.count,
+					ExpiresAt: e.expiresAt,
+				})
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Restore reads a snapshot written by [LRUBackend.Snapshot] and loads it with
+// [LRUBackend.Load]. It returns the number of counters loaded; expired ones
+// are skipped.
+func (l *LRUBackend) Restore(r io.Reader) (int, error) {
+	return DecodeSnapshot(r, l.Load)
+}
+
+// Load adds records to the backend, replacing the counters of the same keys,
+// and returns how many were loaded. Records whose window has already expired
+// are skipped, as are new keys rejected by a saturated backend (see
+// [WithRejectWhenFull]). Load stops at the first record with an invalid key.
+func (l *LRUBackend) Load(records ...Record) (int, error) {
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := 0
+	for _, r := range records {
+		ruleID, userKey, err := parseKey(r.Key)
+		if err != nil {
+			return n, fmt.Errorf("%w: %q", err, r.Key)
+		}
+		if !r.ExpiresAt.After(now) {
+			continue
+		}
+		if l.store(ruleID, userKey, &entry{count: r.Count, window: r.Window, expiresAt: r.ExpiresAt}, now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// DecodeSnapshot reads the records of a snapshot from r and passes each one to
+// load, returning the total it reports as loaded.
+func DecodeSnapshot(r io.Reader, load func(...Record) (int, error)) (int, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	total := 0
+	for {
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return total, nil
+			}
+			return total, fmt.Errorf("lrubackend: decode snapshot: %w", err)
+		}
+		n, err := load(rec)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// SaveFile writes a snapshot to path. The snapshot goes to a temporary file in
+// the same directory first, so a crash never leaves a truncated snapshot.
+func (l *LRUBackend) SaveFile(path string) error {
+	return WriteSnapshotFile(path, l.Snapshot)
+}
+
+// RestoreFile loads the snapshot at path, if any. A missing file is not an
+// error: it loads nothing, as on a first start.
+func (l *LRUBackend) RestoreFile(path string) (int, error) {
+	return ReadSnapshotFile(path, l.Restore)
+}
+
+// WriteSnapshotFile atomically replaces path with the output of snapshot.
+// It backs [LRUBackend.SaveFile] and is exported for other in-memory backends.
+func WriteSnapshotFile(path string, snapshot func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op once renamed
+
+	if err := snapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// ReadSnapshotFile opens path and passes it to restore. A missing file loads
+// nothing. It backs [LRUBackend.RestoreFile] and is exported for other
+// in-memory backends.
+func ReadSnapshotFile(path string, restore func(io.Reader) (int, error)) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return restore(f)
+}
@@ -0,0 +1,118 @@
+package lrubackend
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/logocomune/yarl/v4/yarltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUBackend_SnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	b := New(rules(time.Minute), 100, WithClock(clock))
+
+	b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+	b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+	b.IncAndGetTTL(ctx, "r1:short", time.Second)
+	b.IncAndGetTTL(ctx, "daily:user1", 24*time.Hour)
+
+	clock.Advance(2 * time.Second)
+	var buf bytes.Buffer
+	require.NoError(t, b.Snapshot(&buf))
+	assert.Equal(t, 2, strings.Count(buf.String(), "\n"), "expired counters are not written")
+
+	clock.Advance(10 * time.Second)
+	restored := New(nil, 100, WithClock(clock))
+	n, err := restored.Restore(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	count, remaining, err := restored.Get(ctx, "r1:user1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, 48*time.Second, remaining, "windows keep their absolute expiry")
+
+	count, _, err = restored.IncAndGetTTL(ctx, "daily:user1", 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestLRUBackend_Restore_SkipsExpired(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	b := New(nil, 100, WithClock(clock))
+	b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+
+	var buf bytes.Buffer
+	require.NoError(t, b.Snapshot(&buf))
+
+	clock.Advance(time.Minute)
+	restored := New(nil, 100, WithClock(clock))
+	n, err := restored.Restore(&buf)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Zero(t, restored.Len())
+}
+
+func TestLRUBackend_Restore_KeepsRecency(t *testing.T) {
+	ctx := context.Background()
+	b := New(nil, 2)
+	b.IncAndGetTTL(ctx, "r1:old", time.Minute)
+	b.IncAndGetTTL(ctx, "r1:new", time.Minute)
+
+	var buf bytes.Buffer
+	require.NoError(t, b.Snapshot(&buf))
+	restored := New(nil, 2)
+	_, err := restored.Restore(&buf)
+	require.NoError(t, err)
+
+	restored.IncAndGetTTL(ctx, "r1:third", time.Minute)
+	count, _, _ := restored.Get(ctx, "r1:new")
+	assert.Equal(t, int64(1), count)
+	count, _, _ = restored.Get(ctx, "r1:old")
+	assert.Zero(t, count, "the least recently used counter is evicted first")
+}
+
+func TestLRUBackend_Restore_Invalid(t *testing.T) {
+	b := New(nil, 100)
+
+	_, err := b.Restore(strings.NewReader("not json"))
+	assert.ErrorContains(t, err, "decode snapshot")
+
+	n, err := b.Restore(strings.NewReader(`{"key":"nocolon","window":60000000000,"count":1,"expires_at":"2999-01-01T00:00:00Z"}`))
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	assert.Zero(t, n)
+}
+
+func TestLRUBackend_SaveFileRestoreFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "counters.jsonl")
+
+	b := New(nil, 100)
+	n, err := b.RestoreFile(path)
+	require.NoError(t, err, "a missing snapshot is a first start")
+	assert.Zero(t, n)
+
+	b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+	require.NoError(t, b.SaveFile(path))
+	b.IncAndGetTTL(ctx, "r1:user1", time.Minute)
+	require.NoError(t, b.SaveFile(path), "SaveFile replaces an existing snapshot")
+
+	restored := New(nil, 100)
+	n, err = restored.RestoreFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	count, _, _ := restored.Get(ctx, "r1:user1")
+	assert.Equal(t, int64(2), count)
+
+	matches, err := filepath.Glob(path + ".tmp*")
+	require.NoError(t, err)
+	assert.Empty(t, matches, "temporary files must be cleaned up")
+}
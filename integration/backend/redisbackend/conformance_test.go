@@ -0,0 +1,16 @@
+package redisbackend
+
+import (
+	"testing"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/integration/backend/backendtest"
+)
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) yarl.Backend {
+		client := redisClient(t)
+		t.Cleanup(func() { client.Close() })
+		return NewFromClient(client)
+	})
+}
@@ -0,0 +1,54 @@
+package redisbackend
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireScript keeps the leases of one key in a sorted set scored by expiry
+// (milliseconds, Redis server clock). It drops expired leases, adds the new one
+// if a slot is free, and keeps the set alive until its last lease expires.
+//
+// KEYS[1] = lease set, ARGV[1] = lease ID, ARGV[2] = max leases, ARGV[3] = ttl in ms.
+// Returns {acquired (0/1), leases held, ms until the oldest lease expires}.
+var acquireScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local max = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+local held = redis.call('ZCARD', KEYS[1])
+local acquired = 0
+if held < max then
+	redis.call('ZADD', KEYS[1], now + ttl, ARGV[1])
+	held = held + 1
+	acquired = 1
+end
+if held == 0 then
+	return {acquired, 0, 0}
+end
+
+local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+redis.call('PEXPIRE', KEYS[1], math.max(tonumber(newest[2]) - now, 1))
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return {acquired, held, tonumber(oldest[2]) - now}
+`)
+
+// Acquire drops the expired leases of key and adds leaseID if fewer than max
+// remain, in a single atomic Lua script. Lease expiry uses the Redis server clock,
+// so application servers with skewed clocks agree on it. Implements [yarl.LeaseBackend].
+func (r *RedisBackend) Acquire(ctx context.Context, key, leaseID string, max int64, ttl time.Duration) (bool, int64, time.Duration, error) {
+	vals, err := acquireScript.Run(ctx, r.client, []string{key}, leaseID, max, ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return false, 0, 0, err
+	}
+	return vals[0] == 1, vals[1], time.Duration(vals[2]) * time.Millisecond, nil
+}
+
+// Release removes leaseID from key. Implements [yarl.LeaseBackend].
+func (r *RedisBackend) Release(ctx context.Context, key, leaseID string) error {
+	return r.client.ZRem(ctx, key, leaseID).Err()
+}
@@ -6,6 +6,7 @@ package redisbackend
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -92,3 +93,45 @@ func (r *RedisBackend) IncAndGetTTLBatch(ctx context.Context, entries []yarl.Bat
 	}
 	return results, nil
 }
+
+// Get returns the counter value and remaining TTL for key without incrementing it.
+// A missing key yields (0, 0, nil). Implements [yarl.PeekBackend].
+func (r *RedisBackend) Get(ctx context.Context, key string) (int64, time.Duration, error) {
+	pipe := r.client.Pipeline()
+	getCmd := pipe.Get(ctx, key)
+	ttlCmd := pipe.TTL(ctx, key)
+
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, 0, err
+	}
+
+	count, err := getCmd.Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, max(ttlCmd.Val(), 0), nil
+}
+
+// Reset deletes the counter for key. Implements [yarl.ResetBackend].
+func (r *RedisBackend) Reset(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
+
+// decrementScript lowers a counter that exists and is above 0. DECR alone would
+// create an expired key anew, without a TTL, at -1.
+var decrementScript = redis.NewScript(`
+local count = tonumber(redis.call('GET', KEYS[1]))
+if count and count > 0 then
+	redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+// Decrement lowers the counter for key by 1, keeping its TTL.
+// Implements [yarl.RefundBackend].
+func (r *RedisBackend) Decrement(ctx context.Context, key string) error {
+	return decrementScript.Run(ctx, r.client, []string{key}).Err()
+}
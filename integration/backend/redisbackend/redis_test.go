@@ -148,3 +148,106 @@ func TestRedisBackend_IncAndGetTTLBatch_TTLNotRefreshed(t *testing.T) {
 
 	assert.Less(t, second[0].Remaining, first[0].Remaining, "batch ExpireNX must not refresh TTL")
 }
+
+func TestRedisBackend_Get(t *testing.T) {
+	client := redisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	key := fmt.Sprintf("test:get:%d", time.Now().UnixNano())
+	client.Del(ctx, key)
+
+	b := NewFromClient(client)
+
+	count, remaining, err := b.Get(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+	assert.Equal(t, time.Duration(0), remaining)
+
+	_, _, err = b.IncAndGetTTL(ctx, key, 10*time.Second)
+	require.NoError(t, err)
+
+	count, remaining, err = b.Get(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Greater(t, remaining, time.Duration(0))
+
+	count, _, _ = b.Get(ctx, key)
+	assert.Equal(t, int64(1), count, "Get must not increment")
+}
+
+func TestRedisBackend_Reset(t *testing.T) {
+	client := redisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	key := fmt.Sprintf("test:reset:%d", time.Now().UnixNano())
+
+	b := NewFromClient(client)
+	_, _, err := b.IncAndGetTTL(ctx, key, 10*time.Second)
+	require.NoError(t, err)
+
+	require.NoError(t, b.Reset(ctx, key))
+
+	count, _, err := b.IncAndGetTTL(ctx, key, 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "counter must restart after Reset")
+	client.Del(ctx, key)
+}
+
+func TestRedisBackend_AcquireRelease(t *testing.T) {
+	client := redisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	key := fmt.Sprintf("test:lease:%d", time.Now().UnixNano())
+	defer client.Del(ctx, key)
+
+	b := NewFromClient(client)
+
+	ok, held, oldest, err := b.Acquire(ctx, key, "l1", 2, 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), held)
+	assert.InDelta(t, 10, oldest.Seconds(), 1)
+
+	ok, held, _, err = b.Acquire(ctx, key, "l2", 2, 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), held)
+
+	ok, held, oldest, err = b.Acquire(ctx, key, "l3", 2, 10*time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, int64(2), held)
+	assert.Greater(t, oldest, time.Duration(0))
+
+	require.NoError(t, b.Release(ctx, key, "l1"))
+	ok, _, _, err = b.Acquire(ctx, key, "l3", 2, 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok, "a released slot must be reusable")
+
+	assert.Greater(t, client.PTTL(ctx, key).Val(), time.Duration(0), "lease set must expire with its newest lease")
+}
+
+func TestRedisBackend_Acquire_ExpiredLeasesFreeSlots(t *testing.T) {
+	client := redisClient(t)
+	defer client.Close()
+
+	ctx := context.Background()
+	key := fmt.Sprintf("test:lease:exp:%d", time.Now().UnixNano())
+	defer client.Del(ctx, key)
+
+	b := NewFromClient(client)
+
+	ok, _, _, err := b.Acquire(ctx, key, "crashed", 1, 500*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	time.Sleep(time.Second)
+
+	ok, held, _, err := b.Acquire(ctx, key, "l2", 1, 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok, "an unreleased lease must stop counting after its TTL")
+	assert.Equal(t, int64(1), held)
+}
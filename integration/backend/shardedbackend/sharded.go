@@ -0,0 +1,189 @@
+// Package shardedbackend provides an in-memory YARL backend for high concurrency.
+//
+// A [ShardedBackend] spreads user keys over N independent [lrubackend.LRUBackend]
+// shards, each with its own lock and per-rule LRU caches, so requests for
+// different users rarely contend. All rules of one user key land in the same
+// shard.
+package shardedbackend
+
+import (
+	"context"
+	"hash/maphash"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/integration/backend/lrubackend"
+)
+
+// ShardedBackend is a thread-safe in-memory rate-limit backend made of
+// independently locked shards. Create one with [New].
+type ShardedBackend struct {
+	seed   maphash.Seed
+	shards []*lrubackend.LRUBackend
+}
+
+// New creates a ShardedBackend with the given number of shards; shards <= 0
+// uses 4×GOMAXPROCS. rules and opts are passed to every shard, as for
+// [lrubackend.New]. sizePerRule is the total number of user keys tracked per
+// rule; it is split evenly across the shards, rounding up. Options apply to
+// each shard on its own: divide a [lrubackend.WithMemoryBudget] by shards.
+func New(rules []yarl.Rule, shards, sizePerRule int, opts ...lrubackend.Option) *ShardedBackend {
+	if shards <= 0 {
+		shards = 4 * runtime.GOMAXPROCS(0)
+	}
+	perShard := (sizePerRule + shards - 1) / shards
+
+	s := &ShardedBackend{seed: maphash.MakeSeed(), shards: make([]*lrubackend.LRUBackend, shards)}
+	for i := range s.shards {
+		s.shards[i] = lrubackend.New(rules, perShard, opts...)
+	}
+	return s
+}
+
+// shard returns the shard of key, chosen by the hash of its user part so all
+// rules of a user share a shard.
+func (s *ShardedBackend) shard(key string) *lrubackend.LRUBackend {
+	_, userKey, _ := strings.Cut(key, ":")
+	return s.shards[maphash.String(s.seed, userKey)%uint64(len(s.shards))]
+}
+
+// IncAndGetTTL implements [yarl.Backend]. key must have the format "{ruleID}:{userKey}".
+func (s *ShardedBackend) IncAndGetTTL(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	return s.shard(key).IncAndGetTTL(ctx, key, ttl)
+}
+
+// IncAndGetTTLBatch implements [yarl.BatchBackend]. Entries are grouped by
+// shard and each group runs under one lock acquisition of its shard; the
+// entries of a single user key always share one group.
+func (s *ShardedBackend) IncAndGetTTLBatch(ctx context.Context, entries []yarl.BatchEntry) ([]yarl.BatchResult, error) {
+	groups := make(map[*lrubackend.LRUBackend][]int, 1)
+	for i, e := range entries {
+		shard := s.shard(e.Key)
+		groups[shard] = append(groups[shard], i)
+	}
+
+	results := make([]yarl.BatchResult, len(entries))
+	for shard, idx := range groups {
+		group := make([]yarl.BatchEntry, len(idx))
+		for j, i := range idx {
+			group[j] = entries[i]
+		}
+		res, err := shard.IncAndGetTTLBatch(ctx, group)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range idx {
+			results[i] = res[j]
+		}
+	}
+	return results, nil
+}
+
+// Get implements [yarl.PeekBackend].
+func (s *ShardedBackend) Get(ctx context.Context, key string) (int64, time.Duration, error) {
+	return s.shard(key).Get(ctx, key)
+}
+
+// Reset implements [yarl.ResetBackend].
+func (s *ShardedBackend) Reset(ctx context.Context, key string) error {
+	return s.shard(key).Reset(ctx, key)
+}
+
+// Decrement implements [yarl.RefundBackend].
+func (s *ShardedBackend) Decrement(ctx context.Context, key string) error {
+	return s.shard(key).Decrement(ctx, key)
+}
+
+// Acquire implements [yarl.LeaseBackend].
+func (s *ShardedBackend) Acquire(ctx context.Context, key, leaseID string, max int64, ttl time.Duration) (bool, int64, time.Duration, error) {
+	return s.shard(key).Acquire(ctx, key, leaseID, max, ttl)
+}
+
+// Release implements [yarl.LeaseBackend].
+func (s *ShardedBackend) Release(ctx context.Context, key, leaseID string) error {
+	return s.shard(key).Release(ctx, key, leaseID)
+}
+
+// Len returns the number of counters held across all shards.
+func (s *ShardedBackend) Len() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// Evictions returns how many live counters the shards dropped because a cache
+// was full. Keys do not spread perfectly evenly, so a shard may evict before
+// the total reaches sizePerRule.
+func (s *ShardedBackend) Evictions() uint64 {
+	var n uint64
+	for _, shard := range s.shards {
+		n += shard.Evictions()
+	}
+	return n
+}
+
+// Bytes returns the estimated memory held by the counters of all shards.
+func (s *ShardedBackend) Bytes() int64 {
+	var n int64
+	for _, shard := range s.shards {
+		n += shard.Bytes()
+	}
+	return n
+}
+
+// Rejections returns how many new keys the shards denied because they were
+// full; see [lrubackend.WithRejectWhenFull].
+func (s *ShardedBackend) Rejections() uint64 {
+	var n uint64
+	for _, shard := range s.shards {
+		n += shard.Rejections()
+	}
+	return n
+}
+
+// Snapshot writes the live counters of every shard to w, in the format of
+// [lrubackend.LRUBackend.Snapshot].
+func (s *ShardedBackend) Snapshot(w io.Writer) error {
+	for _, shard := range s.shards {
+		if err := shard.Snapshot(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore reads a snapshot and loads every counter into the shard of its key.
+// The snapshot may come from an [lrubackend.LRUBackend] or from a
+// ShardedBackend with any number of shards.
+func (s *ShardedBackend) Restore(r io.Reader) (int, error) {
+	return lrubackend.DecodeSnapshot(r, s.Load)
+}
+
+// Load adds records to the shards of their keys, like
+// [lrubackend.LRUBackend.Load].
+func (s *ShardedBackend) Load(records ...lrubackend.Record) (int, error) {
+	total := 0
+	for _, r := range records {
+		n, err := s.shard(r.Key).Load(r)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// SaveFile atomically writes a snapshot to path.
+func (s *ShardedBackend) SaveFile(path string) error {
+	return lrubackend.WriteSnapshotFile(path, s.Snapshot)
+}
+
+// RestoreFile loads the snapshot at path, if any; a missing file loads nothing.
+func (s *ShardedBackend) RestoreFile(path string) (int, error) {
+	return lrubackend.ReadSnapshotFile(path, s.Restore)
+}
@@ -0,0 +1,138 @@
+package shardedbackend
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/integration/backend/backendtest"
+	"github.com/logocomune/yarl/v4/integration/backend/lrubackend"
+	"github.com/logocomune/yarl/v4/yarltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var benchRules = []yarl.Rule{
+	{ID: "burst", TTL: time.Second, MaxRequests: 1_000_000},
+	{ID: "sustained", TTL: time.Minute, MaxRequests: 1_000_000},
+	{ID: "daily", TTL: 24 * time.Hour, MaxRequests: 1_000_000},
+}
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) yarl.Backend {
+		return New(nil, 8, 1000)
+	})
+}
+
+func TestNew_Shards(t *testing.T) {
+	assert.Len(t, New(benchRules, 16, 100).shards, 16)
+	assert.NotEmpty(t, New(benchRules, 0, 100).shards, "shards <= 0 picks a default")
+}
+
+func TestShardedBackend_UserKeysShareAShard(t *testing.T) {
+	s := New(benchRules, 64, 100)
+	for i := range 100 {
+		user := fmt.Sprintf("user-%d", i)
+		assert.Same(t, s.shard("burst:"+user), s.shard("daily:"+user))
+	}
+}
+
+func TestShardedBackend_LenAndEvictions(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	s := New([]yarl.Rule{{ID: "r", TTL: time.Minute, MaxRequests: 10}}, 4, 4, lrubackend.WithClock(clock))
+
+	for i := range 100 {
+		_, _, err := s.IncAndGetTTL(ctx, fmt.Sprintf("r:user-%d", i), time.Minute)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 4, s.Len(), "4 shards of one entry each")
+	assert.Equal(t, uint64(96), s.Evictions())
+}
+
+// BenchmarkParallelCheck compares a Limiter with three rules on the single-lock
+// LRU backend and on the sharded backend, with every goroutine cycling through
+// its own set of users.
+func BenchmarkParallelCheck(b *testing.B) {
+	backends := []struct {
+		name    string
+		backend yarl.Backend
+	}{
+		{"lru", lrubackend.New(benchRules, 100_000)},
+		{"sharded", New(benchRules, 0, 100_000)},
+	}
+	for _, bb := range backends {
+		b.Run(bb.name, func(b *testing.B) {
+			l := yarl.New(bb.backend, benchRules...)
+			ctx := context.Background()
+			var next atomic.Uint64
+			b.RunParallel(func(pb *testing.PB) {
+				g := next.Add(1) // one distinct set of users per goroutine
+				keys := make([]string, 1000)
+				for i := range keys {
+					keys[i] = fmt.Sprintf("user-%d-%d", g, i)
+				}
+				i := 0
+				for pb.Next() {
+					if _, err := l.Check(ctx, keys[i%len(keys)]); err != nil {
+						b.Fatal(err)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+func TestShardedBackend_IncAndGetTTLBatch(t *testing.T) {
+	ctx := context.Background()
+	s := New(nil, 16, 100)
+
+	var entries []yarl.BatchEntry
+	for i := range 20 {
+		entries = append(entries, yarl.BatchEntry{Key: fmt.Sprintf("r:user-%d", i), TTL: time.Minute})
+	}
+	_, err := s.IncAndGetTTLBatch(ctx, entries)
+	require.NoError(t, err)
+	entries = append(entries, yarl.BatchEntry{Key: "r:new", TTL: time.Minute})
+
+	results, err := s.IncAndGetTTLBatch(ctx, entries)
+	require.NoError(t, err)
+	require.Len(t, results, len(entries))
+	for i, r := range results[:20] {
+		assert.Equal(t, int64(2), r.Count, entries[i].Key)
+	}
+	assert.Equal(t, int64(1), results[20].Count, "results must keep the order of entries")
+}
+
+func TestShardedBackend_SnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	s := New(nil, 8, 100)
+	for i := range 20 {
+		_, _, err := s.IncAndGetTTL(ctx, fmt.Sprintf("r:user-%d", i), time.Minute)
+		require.NoError(t, err)
+	}
+	path := filepath.Join(t.TempDir(), "counters.jsonl")
+	require.NoError(t, s.SaveFile(path))
+
+	// A snapshot can be restored into a different number of shards, or into a
+	// single LRU backend.
+	resharded := New(nil, 3, 100)
+	n, err := resharded.RestoreFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 20, n)
+	assert.Equal(t, 20, resharded.Len())
+
+	lru := lrubackend.New(nil, 100)
+	n, err = lru.RestoreFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 20, n)
+
+	count, _, err := resharded.IncAndGetTTL(ctx, "r:user-7", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
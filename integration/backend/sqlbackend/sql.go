@@ -0,0 +1,249 @@
+// Package sqlbackend provides a database/sql backend for YARL, for deployments
+// with PostgreSQL or SQLite but no Redis.
+//
+// Each counter is one row keyed by "{ruleID}:{userKey}". Increments are single
+// INSERT ... ON CONFLICT statements, so they are atomic across processes; a
+// row whose window has ended is restarted by the same statement. Expired rows
+// are otherwise left in place until [SQLBackend.Cleanup] deletes them.
+//
+// Window ends are stored as Unix milliseconds computed from the application's
+// clock, so the clocks of the processes sharing a table must be synchronized.
+//
+// With SQLite, open the database with a busy timeout and in WAL mode, e.g. the
+// DSN "file:ratelimit.db?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+// with modernc.org/sqlite. The busy timeout is a per-connection setting that
+// New cannot apply to the pool; without it concurrent increments fail with
+// SQLITE_BUSY instead of waiting for the write lock.
+//
+// The tests run the SQLite dialect only. The Postgres dialect is not exercised
+// against a real PostgreSQL server.
+package sqlbackend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+)
+
+// DefaultTable is the table used unless [WithTable] is given.
+const DefaultTable = "yarl_counters"
+
+// Dialect selects the SQL flavour of the database.
+type Dialect int
+
+const (
+	// Postgres targets PostgreSQL 9.5 or later.
+	Postgres Dialect = iota
+	// SQLite targets SQLite 3.35 or later.
+	SQLite
+)
+
+// param returns the n-th (1-based) bind parameter. Both dialects accept
+// numbered parameters that may be repeated within a statement.
+func (d Dialect) param(n int) string {
+	if d == SQLite {
+		return fmt.Sprintf("?%d", n)
+	}
+	return fmt.Sprintf("$%d", n)
+}
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// SQLBackend is a rate-limit backend storing counters in a SQL table.
+// Create one with [New] and create its table with [SQLBackend.Migrate].
+type SQLBackend struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+	clock   yarl.Clock
+
+	incQuery     string
+	getQuery     string
+	resetQuery   string
+	decQuery     string
+	cleanupQuery string
+}
+
+// Option configures an SQLBackend created with [New].
+type Option func(*SQLBackend)
+
+// WithTable stores the counters in table instead of [DefaultTable]. The name
+// may be schema-qualified ("ratelimit.counters").
+func WithTable(table string) Option {
+	return func(s *SQLBackend) {
+		s.table = table
+	}
+}
+
+// WithClock makes the backend read the time from c instead of the system clock.
+func WithClock(c yarl.Clock) Option {
+	return func(s *SQLBackend) {
+		s.clock = c
+	}
+}
+
+// New creates an SQLBackend on db. It returns an error if the table name is
+// not a plain SQL identifier.
+func New(db *sql.DB, dialect Dialect, opts ...Option) (*SQLBackend, error) {
+	s := &SQLBackend{db: db, dialect: dialect, table: DefaultTable, clock: yarl.SystemClock}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if !tableName.MatchString(s.table) {
+		return nil, fmt.Errorf("sqlbackend: invalid table name %q", s.table)
+	}
+
+	p := dialect.param
+	s.incQuery = fmt.Sprintf(`INSERT INTO %[1]s (key, count, expires_at) VALUES (%[2]s, 1, %[3]s)
+ON CONFLICT (key) DO UPDATE SET
+	count = CASE WHEN %[1]s.expires_at <= %[4]s THEN 1 ELSE %[1]s.count + 1 END,
+	expires_at = CASE WHEN %[1]s.expires_at <= %[4]s THEN excluded.expires_at ELSE %[1]s.expires_at END
+RETURNING count, expires_at`, s.table, p(1), p(2), p(3))
+	s.getQuery = fmt.Sprintf(`SELECT count, expires_at FROM %s WHERE key = %s AND expires_at > %s`, s.table, p(1), p(2))
+	s.resetQuery = fmt.Sprintf(`DELETE FROM %s WHERE key = %s`, s.table, p(1))
+	s.decQuery = fmt.Sprintf(`UPDATE %s SET count = count - 1 WHERE key = %s AND expires_at > %s AND count > 0`, s.table, p(1), p(2))
+	s.cleanupQuery = fmt.Sprintf(`DELETE FROM %s WHERE expires_at <= %s`, s.table, p(1))
+	return s, nil
+}
+
+// Migrate creates the counters table and its expiry index if they do not
+// exist. It is safe to run on every start.
+func (s *SQLBackend) Migrate(ctx context.Context) error {
+	// The index lives next to its table. PostgreSQL takes an unqualified index
+	// name and a qualified table; SQLite wants the schema on the index name and
+	// an unqualified table.
+	schema, name := "", s.table
+	if i := strings.LastIndex(s.table, "."); i >= 0 {
+		schema, name = s.table[:i+1], s.table[i+1:]
+	}
+	index := fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_expires_at ON %s (expires_at)`, name, s.table)
+	if s.dialect == SQLite {
+		index = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s%s_expires_at ON %s (expires_at)`, schema, name, name)
+	}
+	for _, stmt := range []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	key TEXT PRIMARY KEY,
+	count BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL
+)`, s.table),
+		index,
+	} {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("sqlbackend: migrate: %w", err)
+		}
+	}
+	return nil
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// IncAndGetTTL increments the counter for key in one upsert, starting a new
+// window of ttl if the key is missing or its window has ended, and returns the
+// new value and remaining window duration.
+func (s *SQLBackend) IncAndGetTTL(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	return s.inc(ctx, s.db, key, ttl, s.clock.Now())
+}
+
+// IncAndGetTTLBatch increments every entry in one transaction, so either all
+// counters change or none do. Implements [yarl.BatchBackend].
+func (s *SQLBackend) IncAndGetTTLBatch(ctx context.Context, entries []yarl.BatchEntry) ([]yarl.BatchResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	now := s.clock.Now()
+	results := make([]yarl.BatchResult, len(entries))
+	for i, e := range entries {
+		count, remaining, err := s.inc(ctx, tx, e.Key, e.TTL, now)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = yarl.BatchResult{Count: count, Remaining: remaining}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *SQLBackend) inc(ctx context.Context, q queryer, key string, ttl time.Duration, now time.Time) (int64, time.Duration, error) {
+	var count, expiresAt int64
+	err := q.QueryRowContext(ctx, s.incQuery, key, now.Add(ttl).UnixMilli(), now.UnixMilli()).Scan(&count, &expiresAt)
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, remaining(expiresAt, now), nil
+}
+
+// Get returns the counter value and remaining window for key without
+// incrementing it. Missing and expired keys yield (0, 0, nil).
+// Implements [yarl.PeekBackend].
+func (s *SQLBackend) Get(ctx context.Context, key string) (int64, time.Duration, error) {
+	now := s.clock.Now()
+	var count, expiresAt int64
+	err := s.db.QueryRowContext(ctx, s.getQuery, key, now.UnixMilli()).Scan(&count, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, remaining(expiresAt, now), nil
+}
+
+// Reset deletes the counter for key. Implements [yarl.ResetBackend].
+func (s *SQLBackend) Reset(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, s.resetQuery, key)
+	return err
+}
+
+// Decrement lowers the counter for key by 1, keeping its window.
+// Implements [yarl.RefundBackend].
+func (s *SQLBackend) Decrement(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, s.decQuery, key, s.clock.Now().UnixMilli())
+	return err
+}
+
+// Cleanup deletes the rows whose window has ended and returns how many it
+// deleted. Expired rows never affect a decision, but they take space.
+func (s *SQLBackend) Cleanup(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, s.cleanupQuery, s.clock.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// RunCleanup calls [SQLBackend.Cleanup] every interval until ctx is done, then
+// returns ctx.Err(). Failed runs are passed to onError, which may be nil, and
+// retried at the next interval. Run it in its own goroutine:
+//
+//	go backend.RunCleanup(ctx, time.Minute, nil)
+func (s *SQLBackend) RunCleanup(ctx context.Context, interval time.Duration, onError func(error)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.clock.After(interval):
+		}
+		if _, err := s.Cleanup(ctx); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+	}
+}
+
+// remaining converts a window end in Unix milliseconds to the time left.
+func remaining(expiresAt int64, now time.Time) time.Duration {
+	return time.UnixMilli(expiresAt).Sub(now)
+}
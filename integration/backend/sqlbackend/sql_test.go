@@ -0,0 +1,173 @@
+package sqlbackend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/integration/backend/backendtest"
+	"github.com/logocomune/yarl/v4/yarltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+// newSQLite returns a migrated SQLBackend on a fresh SQLite file.
+func newSQLite(t *testing.T, opts ...Option) (*SQLBackend, *sql.DB) {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "yarl.db") + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	s, err := New(db, SQLite, opts...)
+	require.NoError(t, err)
+	require.NoError(t, s.Migrate(context.Background()))
+	return s, db
+}
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) yarl.Backend {
+		s, _ := newSQLite(t)
+		return s
+	})
+}
+
+func TestNew_InvalidTable(t *testing.T) {
+	for _, table := range []string{"", "1counters", "counters; DROP TABLE users", "a.b.c"} {
+		_, err := New(nil, Postgres, WithTable(table))
+		assert.Error(t, err, table)
+	}
+	_, err := New(nil, Postgres, WithTable("ratelimit.counters"))
+	assert.NoError(t, err)
+}
+
+func TestSQLBackend_Queries(t *testing.T) {
+	s, err := New(nil, Postgres)
+	require.NoError(t, err)
+	assert.Contains(t, s.incQuery, "VALUES ($1, 1, $2)")
+	assert.Contains(t, s.incQuery, "yarl_counters.expires_at <= $3")
+
+	s, err = New(nil, SQLite, WithTable("limits"))
+	require.NoError(t, err)
+	assert.Contains(t, s.incQuery, "VALUES (?1, 1, ?2)")
+	assert.Contains(t, s.getQuery, "FROM limits WHERE key = ?1")
+}
+
+func TestSQLBackend_Migrate_Idempotent(t *testing.T) {
+	s, _ := newSQLite(t, WithTable("limits"))
+	assert.NoError(t, s.Migrate(context.Background()))
+}
+
+func TestSQLBackend_SchemaQualifiedTable(t *testing.T) {
+	ctx := context.Background()
+	s, db := newSQLite(t, WithTable("main.limits"))
+	assert.NoError(t, s.Migrate(ctx))
+
+	var index string
+	require.NoError(t, db.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = 'limits' AND name = 'limits_expires_at'`).Scan(&index))
+
+	count, _, err := s.IncAndGetTTL(ctx, "r:alice", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	count, _, err = s.IncAndGetTTL(ctx, "r:alice", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestSQLBackend_WindowRestart(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	s, _ := newSQLite(t, WithClock(clock))
+
+	s.IncAndGetTTL(ctx, "r:alice", time.Minute)
+	clock.Advance(45 * time.Second)
+	count, remaining, err := s.IncAndGetTTL(ctx, "r:alice", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, 15*time.Second, remaining)
+
+	clock.Advance(15 * time.Second)
+	count, _, err = s.Get(ctx, "r:alice")
+	require.NoError(t, err)
+	assert.Zero(t, count, "an ended window reads as missing")
+
+	count, remaining, err = s.IncAndGetTTL(ctx, "r:alice", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "the upsert restarts an ended window")
+	assert.Equal(t, time.Minute, remaining)
+}
+
+func TestSQLBackend_BatchIsAtomic(t *testing.T) {
+	ctx := context.Background()
+	s, db := newSQLite(t)
+
+	_, err := s.IncAndGetTTLBatch(ctx, []yarl.BatchEntry{
+		{Key: "a:alice", TTL: time.Minute},
+		{Key: "b:alice", TTL: time.Minute},
+	})
+	require.NoError(t, err)
+
+	// A trigger makes the second upsert of the next batch fail.
+	_, err = db.ExecContext(ctx, `CREATE TRIGGER fail BEFORE UPDATE ON yarl_counters
+		WHEN old.key = 'b:alice' BEGIN SELECT RAISE(ABORT, 'boom'); END`)
+	require.NoError(t, err)
+
+	_, err = s.IncAndGetTTLBatch(ctx, []yarl.BatchEntry{
+		{Key: "a:alice", TTL: time.Minute},
+		{Key: "b:alice", TTL: time.Minute},
+	})
+	require.Error(t, err)
+
+	count, _, err := s.Get(ctx, "a:alice")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "a failed batch must roll back every increment")
+}
+
+func TestSQLBackend_Cleanup(t *testing.T) {
+	ctx := context.Background()
+	clock := yarltest.NewClock(time.Time{})
+	s, db := newSQLite(t, WithClock(clock))
+
+	s.IncAndGetTTL(ctx, "r:short", time.Second)
+	s.IncAndGetTTL(ctx, "r:long", time.Hour)
+	clock.Advance(time.Minute)
+
+	n, err := s.Cleanup(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	var rows int
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT COUNT(*) FROM yarl_counters").Scan(&rows))
+	assert.Equal(t, 1, rows)
+}
+
+func TestSQLBackend_RunCleanup(t *testing.T) {
+	clock := yarltest.NewClock(time.Time{})
+	s, db := newSQLite(t, WithClock(clock))
+	s.IncAndGetTTL(context.Background(), "r:short", time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var failures atomic.Int32
+	done := make(chan error)
+	go func() {
+		done <- s.RunCleanup(ctx, time.Minute, func(error) { failures.Add(1) })
+	}()
+
+	require.Eventually(t, func() bool { return clock.Waiters() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(time.Minute)
+	require.Eventually(t, func() bool {
+		var rows int
+		require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM yarl_counters").Scan(&rows))
+		return rows == 0
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.True(t, errors.Is(<-done, context.Canceled))
+	assert.Zero(t, failures.Load())
+}
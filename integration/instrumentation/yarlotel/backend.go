@@ -0,0 +1,276 @@
+package yarlotel
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Operation attribute values of the backend spans and metrics.
+const (
+	OpIncAndGetTTL      = "inc_and_get_ttl"
+	OpIncAndGetTTLBatch = "inc_and_get_ttl_batch"
+	OpGet               = "get"
+	OpReset             = "reset"
+	OpDecrement         = "decrement"
+	OpAcquire           = "acquire"
+	OpRelease           = "release"
+)
+
+// InstrumentBackend wraps b so every call runs in a "yarl.backend.{op}" span and
+// records its latency. Spans carry the rule IDs of the keys involved, never the
+// user part of the keys.
+//
+// The wrapper implements exactly the optional interfaces b implements among
+// [yarl.BatchBackend], [yarl.PeekBackend], [yarl.ResetBackend] and
+// [yarl.RefundBackend], so the Limiter's capability checks see b's own.
+// Instrument the [yarl.LeaseBackend] of a [yarl.ConcurrencyLimiter] with
+// [Telemetry.InstrumentLeaseBackend].
+func (t *Telemetry) InstrumentBackend(b yarl.Backend) yarl.Backend {
+	base := &backend{next: b, telemetry: t}
+	var caps int
+	if _, ok := b.(yarl.BatchBackend); ok {
+		caps |= capBatch
+	}
+	if _, ok := b.(yarl.PeekBackend); ok {
+		caps |= capPeek
+	}
+	if _, ok := b.(yarl.ResetBackend); ok {
+		caps |= capReset
+	}
+	if _, ok := b.(yarl.RefundBackend); ok {
+		caps |= capRefund
+	}
+	return wrappers[caps](base)
+}
+
+// InstrumentLeaseBackend wraps b like [Telemetry.InstrumentBackend] does.
+func (t *Telemetry) InstrumentLeaseBackend(b yarl.LeaseBackend) yarl.LeaseBackend {
+	return &leaseBackend{next: b, telemetry: t}
+}
+
+// Optional interfaces of the wrapped backend, as bits indexing wrappers.
+const (
+	capBatch = 1 << iota
+	capPeek
+	capReset
+	capRefund
+)
+
+// wrappers builds, for every combination of optional interfaces, a value
+// exposing the methods of those interfaces and no others. Index with the cap
+// bits of the wrapped backend.
+var wrappers = [16]func(*backend) yarl.Backend{
+	func(b *backend) yarl.Backend { return b },
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+		}{b, batcher{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			peeker
+		}{b, peeker{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			peeker
+		}{b, batcher{b}, peeker{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			resetter
+		}{b, resetter{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			resetter
+		}{b, batcher{b}, resetter{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			peeker
+			resetter
+		}{b, peeker{b}, resetter{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			peeker
+			resetter
+		}{b, batcher{b}, peeker{b}, resetter{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			refunder
+		}{b, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			refunder
+		}{b, batcher{b}, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			peeker
+			refunder
+		}{b, peeker{b}, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			peeker
+			refunder
+		}{b, batcher{b}, peeker{b}, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			resetter
+			refunder
+		}{b, resetter{b}, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			resetter
+			refunder
+		}{b, batcher{b}, resetter{b}, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			peeker
+			resetter
+			refunder
+		}{b, peeker{b}, resetter{b}, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			peeker
+			resetter
+			refunder
+		}{b, batcher{b}, peeker{b}, resetter{b}, refunder{b}}
+	},
+}
+
+// backend instruments the [yarl.Backend] methods of next.
+type backend struct {
+	next      yarl.Backend
+	telemetry *Telemetry
+}
+
+// startBackend opens the span of op over keys and returns the function that ends it.
+func (t *Telemetry) startBackend(ctx context.Context, op string, keys ...string) (context.Context, func(error)) {
+	ruleIDs := make([]string, len(keys))
+	for i, k := range keys {
+		ruleIDs[i], _, _ = strings.Cut(k, ":")
+	}
+	ctx, span := t.tracer.Start(ctx, "yarl.backend."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(AttrOperation.String(op), AttrRuleIDs.StringSlice(ruleIDs)))
+	start := time.Now()
+
+	return ctx, func(err error) {
+		t.backendDuration.Record(ctx, time.Since(start).Seconds(),
+			metric.WithAttributes(AttrOperation.String(op)))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// IncAndGetTTL implements [yarl.Backend].
+func (b *backend) IncAndGetTTL(ctx context.Context, key string, ttl time.Duration) (count int64, remaining time.Duration, err error) {
+	ctx, end := b.telemetry.startBackend(ctx, OpIncAndGetTTL, key)
+	defer func() { end(err) }()
+	return b.next.IncAndGetTTL(ctx, key, ttl)
+}
+
+// The types below each add the method of one optional interface to backend.
+// The wrappers embed *backend next to them so that IncAndGetTTL is promoted
+// from the shallower, unambiguous field.
+
+type batcher struct{ *backend }
+
+// IncAndGetTTLBatch implements [yarl.BatchBackend].
+func (b batcher) IncAndGetTTLBatch(ctx context.Context, entries []yarl.BatchEntry) (results []yarl.BatchResult, err error) {
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = e.Key
+	}
+	ctx, end := b.telemetry.startBackend(ctx, OpIncAndGetTTLBatch, keys...)
+	defer func() { end(err) }()
+	return b.next.(yarl.BatchBackend).IncAndGetTTLBatch(ctx, entries)
+}
+
+type peeker struct{ *backend }
+
+// Get implements [yarl.PeekBackend].
+func (b peeker) Get(ctx context.Context, key string) (count int64, remaining time.Duration, err error) {
+	ctx, end := b.telemetry.startBackend(ctx, OpGet, key)
+	defer func() { end(err) }()
+	return b.next.(yarl.PeekBackend).Get(ctx, key)
+}
+
+type resetter struct{ *backend }
+
+// Reset implements [yarl.ResetBackend].
+func (b resetter) Reset(ctx context.Context, key string) (err error) {
+	ctx, end := b.telemetry.startBackend(ctx, OpReset, key)
+	defer func() { end(err) }()
+	return b.next.(yarl.ResetBackend).Reset(ctx, key)
+}
+
+type refunder struct{ *backend }
+
+// Decrement implements [yarl.RefundBackend].
+func (b refunder) Decrement(ctx context.Context, key string) (err error) {
+	ctx, end := b.telemetry.startBackend(ctx, OpDecrement, key)
+	defer func() { end(err) }()
+	return b.next.(yarl.RefundBackend).Decrement(ctx, key)
+}
+
+// leaseBackend instruments a [yarl.LeaseBackend].
+type leaseBackend struct {
+	next      yarl.LeaseBackend
+	telemetry *Telemetry
+}
+
+// Acquire implements [yarl.LeaseBackend].
+func (b *leaseBackend) Acquire(ctx context.Context, key, leaseID string, max int64, ttl time.Duration) (acquired bool, inFlight int64, oldest time.Duration, err error) {
+	ctx, end := b.telemetry.startBackend(ctx, OpAcquire, key)
+	defer func() { end(err) }()
+	return b.next.Acquire(ctx, key, leaseID, max, ttl)
+}
+
+// Release implements [yarl.LeaseBackend].
+func (b *leaseBackend) Release(ctx context.Context, key, leaseID string) (err error) {
+	ctx, end := b.telemetry.startBackend(ctx, OpRelease, key)
+	defer func() { end(err) }()
+	return b.next.Release(ctx, key, leaseID)
+}
@@ -0,0 +1,188 @@
+// Package yarlotel instruments YARL with OpenTelemetry traces and metrics.
+//
+// Create a [Telemetry] with [New], then:
+//   - call [Telemetry.Check] instead of [yarl.Limiter.Check] to wrap each decision
+//     in a span and count allowed and denied decisions per rule, or register the
+//     Telemetry as a [yarl.Observer] with [yarl.WithObserver] to count decisions
+//     without the span (do not do both, or decisions are counted twice);
+//   - wrap the backend with [Telemetry.InstrumentBackend] before passing it to
+//     [yarl.New] to trace backend calls and record their latency.
+//
+// The middlewares call [yarl.Limiter.Check] themselves, so their decisions get
+// no span unless the Check field of their Configuration is set to
+// [Telemetry.CheckFunc].
+//
+// yarlotel is a separate module with its own go.mod, so OpenTelemetry and the
+// Go version it requires only enter the module graph of programs that import
+// yarlotel, not of every user of yarl.
+//
+// Spans:
+//
+//	yarl.Check             yarl.rule.ids, yarl.allowed, yarl.remaining, yarl.denied_rule.ids,
+//	                       yarl.would_block_rule.ids
+//	yarl.backend.{op}      yarl.rule.ids, yarl.backend.operation
+//
+// Metric instruments:
+//
+//	yarl.decisions         counter     yarl.rule.id, yarl.decision=allowed|denied|would_block
+//	yarl.backend.duration  histogram   yarl.backend.operation
+package yarlotel
+
+import (
+	"context"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the tracer and meter.
+const ScopeName = "github.com/logocomune/yarl/v4/integration/instrumentation/yarlotel"
+
+// Attribute keys set on spans and metric points.
+const (
+	AttrRuleID      = attribute.Key("yarl.rule.id")
+	AttrRuleIDs     = attribute.Key("yarl.rule.ids")
+	AttrAllowed     = attribute.Key("yarl.allowed")
+	AttrRemaining   = attribute.Key("yarl.remaining")
+	AttrDeniedRules = attribute.Key("yarl.denied_rule.ids")
+	AttrWouldBlock  = attribute.Key("yarl.would_block_rule.ids")
+	AttrDecision    = attribute.Key("yarl.decision")
+	AttrOperation   = attribute.Key("yarl.backend.operation")
+)
+
+// Decision attribute values.
+const (
+	DecisionAllowed = "allowed"
+	DecisionDenied  = "denied"
+	// DecisionWouldBlock counts violations of [yarl.Rule.DryRun] rules, which
+	// are reported but not enforced.
+	DecisionWouldBlock = "would_block"
+)
+
+// Telemetry holds the tracer and metric instruments used by the wrappers.
+// Create one with [New].
+type Telemetry struct {
+	tracer          trace.Tracer
+	decisions       metric.Int64Counter
+	backendDuration metric.Float64Histogram
+}
+
+// New creates a Telemetry from tp and mp. A nil provider falls back to the
+// global one registered with [otel.SetTracerProvider] or [otel.SetMeterProvider].
+func New(tp trace.TracerProvider, mp metric.MeterProvider) (*Telemetry, error) {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(ScopeName)
+
+	decisions, err := meter.Int64Counter("yarl.decisions",
+		metric.WithDescription("Rate-limit decisions per rule."),
+		metric.WithUnit("{decision}"))
+	if err != nil {
+		return nil, err
+	}
+	backendDuration, err := meter.Float64Histogram("yarl.backend.duration",
+		metric.WithDescription("Latency of backend operations."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Telemetry{
+		tracer:          tp.Tracer(ScopeName),
+		decisions:       decisions,
+		backendDuration: backendDuration,
+	}, nil
+}
+
+// Check calls l.Check inside a "yarl.Check" span and records one decision per
+// result. The span carries the evaluated rule IDs, whether the request was
+// allowed, the smallest remaining quota, the IDs of the violated rules and of
+// the dry-run rules that would have been violated.
+// Limiter errors are recorded on the span and returned unchanged.
+func (t *Telemetry) Check(ctx context.Context, l *yarl.Limiter, key string) ([]yarl.RuleResult, error) {
+	ctx, span := t.tracer.Start(ctx, "yarl.Check")
+	defer span.End()
+
+	results, err := l.Check(ctx, key)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	t.ObserveResults(ctx, results)
+	span.SetAttributes(resultAttributes(results)...)
+	return results, nil
+}
+
+// CheckFunc returns [Telemetry.Check] bound to l, in the shape of the Check
+// field of the httpratelimit, ginratelimit and grpcratelimit Configurations:
+//
+//	conf := httpratelimit.NewConfiguration(limiter)
+//	conf.Check = telemetry.CheckFunc(limiter)
+func (t *Telemetry) CheckFunc(l *yarl.Limiter) func(ctx context.Context, key string) ([]yarl.RuleResult, error) {
+	return func(ctx context.Context, key string) ([]yarl.RuleResult, error) {
+		return t.Check(ctx, l, key)
+	}
+}
+
+// ObserveResults records one decision per result on the yarl.decisions counter.
+// [Telemetry.Check] calls it; use it directly for results obtained elsewhere,
+// e.g. from a middleware via [yarl.FromContext].
+func (t *Telemetry) ObserveResults(ctx context.Context, results []yarl.RuleResult) {
+	for _, res := range results {
+		decision := DecisionAllowed
+		switch {
+		case !res.Allowed:
+			decision = DecisionDenied
+		case res.WouldBlock:
+			decision = DecisionWouldBlock
+		}
+		t.decisions.Add(ctx, 1, metric.WithAttributes(AttrRuleID.String(res.ID), AttrDecision.String(decision)))
+	}
+}
+
+// Observe implements [yarl.Observer] by calling [Telemetry.ObserveResults].
+// Failed checks are not counted as decisions.
+func (t *Telemetry) Observe(ctx context.Context, d yarl.Decision) {
+	t.ObserveResults(ctx, d.Results)
+}
+
+func resultAttributes(results []yarl.RuleResult) []attribute.KeyValue {
+	ids := make([]string, 0, len(results))
+	var denied, wouldBlock []string
+	remaining := int64(-1)
+	for _, res := range results {
+		ids = append(ids, res.ID)
+		if !res.Allowed {
+			denied = append(denied, res.ID)
+		}
+		if res.WouldBlock {
+			wouldBlock = append(wouldBlock, res.ID)
+		}
+		if r := res.Remaining(); remaining < 0 || r < remaining {
+			remaining = r
+		}
+	}
+	allowed, _ := yarl.Summarize(results)
+
+	attrs := []attribute.KeyValue{AttrRuleIDs.StringSlice(ids), AttrAllowed.Bool(allowed)}
+	if remaining >= 0 {
+		attrs = append(attrs, AttrRemaining.Int64(remaining))
+	}
+	if len(denied) > 0 {
+		attrs = append(attrs, AttrDeniedRules.StringSlice(denied))
+	}
+	if len(wouldBlock) > 0 {
+		attrs = append(attrs, AttrWouldBlock.StringSlice(wouldBlock))
+	}
+	return attrs
+}
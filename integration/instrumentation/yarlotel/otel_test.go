@@ -0,0 +1,202 @@
+package yarlotel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/integration/backend/lrubackend"
+	"github.com/logocomune/yarl/v4/integration/middleware/httpratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var errBackend = errors.New("backend down")
+
+type failingBackend struct{}
+
+func (failingBackend) IncAndGetTTL(context.Context, string, time.Duration) (int64, time.Duration, error) {
+	return 0, 0, errBackend
+}
+
+func newTelemetry(t *testing.T) (*Telemetry, *tracetest.SpanRecorder, *sdkmetric.ManualReader) {
+	t.Helper()
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	tel, err := New(
+		sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+		sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+	)
+	require.NoError(t, err)
+	return tel, spans, reader
+}
+
+func spanAttrs(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range s.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func decisionCounts(t *testing.T, reader *sdkmetric.ManualReader) map[string]int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	counts := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "yarl.decisions" {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				rule, _ := dp.Attributes.Value(AttrRuleID)
+				decision, _ := dp.Attributes.Value(AttrDecision)
+				counts[rule.AsString()+"/"+decision.AsString()] = dp.Value
+			}
+		}
+	}
+	return counts
+}
+
+func TestCheck(t *testing.T) {
+	tel, spans, reader := newTelemetry(t)
+
+	rules := []yarl.Rule{
+		{ID: "burst", TTL: time.Minute, MaxRequests: 1},
+		{ID: "sustained", TTL: time.Hour, MaxRequests: 10},
+	}
+	l := yarl.New(tel.InstrumentBackend(lrubackend.New(rules, 10)), rules...)
+
+	for range 2 {
+		_, err := tel.Check(context.Background(), l, "alice")
+		require.NoError(t, err)
+	}
+
+	ended := spans.Ended()
+	require.Len(t, ended, 4, "one backend span and one Check span per call")
+
+	backendSpan, checkSpan := ended[2], ended[3]
+	assert.Equal(t, "yarl.backend."+OpIncAndGetTTLBatch, backendSpan.Name())
+	assert.Equal(t, checkSpan.SpanContext().SpanID(), backendSpan.Parent().SpanID())
+	assert.Equal(t, []string{"burst", "sustained"}, spanAttrs(backendSpan)[AttrRuleIDs].AsStringSlice())
+
+	assert.Equal(t, "yarl.Check", checkSpan.Name())
+	attrs := spanAttrs(checkSpan)
+	assert.Equal(t, []string{"burst", "sustained"}, attrs[AttrRuleIDs].AsStringSlice())
+	assert.False(t, attrs[AttrAllowed].AsBool())
+	assert.Equal(t, int64(0), attrs[AttrRemaining].AsInt64())
+	assert.Equal(t, []string{"burst"}, attrs[AttrDeniedRules].AsStringSlice())
+
+	assert.Equal(t, map[string]int64{
+		"burst/allowed":     1,
+		"burst/denied":      1,
+		"sustained/allowed": 2,
+	}, decisionCounts(t, reader))
+}
+
+func TestCheck_BackendError(t *testing.T) {
+	tel, spans, reader := newTelemetry(t)
+	l := yarl.New(tel.InstrumentBackend(failingBackend{}), yarl.Rule{ID: "r", TTL: time.Minute, MaxRequests: 1})
+
+	_, err := tel.Check(context.Background(), l, "alice")
+	require.ErrorIs(t, err, errBackend)
+
+	ended := spans.Ended()
+	require.Len(t, ended, 2)
+	for _, s := range ended {
+		assert.Equal(t, codes.Error, s.Status().Code, s.Name())
+	}
+	assert.Empty(t, decisionCounts(t, reader))
+}
+
+func TestCheckFunc_Middleware(t *testing.T) {
+	tel, spans, reader := newTelemetry(t)
+	rules := []yarl.Rule{{ID: "burst", TTL: time.Minute, MaxRequests: 1}}
+	l := yarl.New(lrubackend.New(rules, 10), rules...)
+
+	conf := httpratelimit.NewConfiguration(l)
+	conf.Check = tel.CheckFunc(l)
+	h := httpratelimit.New(conf, func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, want, w.Code)
+	}
+
+	ended := spans.Ended()
+	require.Len(t, ended, 2, "one Check span per request")
+	assert.Equal(t, "yarl.Check", ended[1].Name())
+	assert.False(t, spanAttrs(ended[1])[AttrAllowed].AsBool())
+	assert.Equal(t, map[string]int64{"burst/allowed": 1, "burst/denied": 1}, decisionCounts(t, reader))
+}
+
+func TestInstrumentBackend_Capabilities(t *testing.T) {
+	tel, spans, _ := newTelemetry(t)
+
+	plain := tel.InstrumentBackend(failingBackend{})
+	assert.NotImplements(t, (*yarl.BatchBackend)(nil), plain)
+	assert.NotImplements(t, (*yarl.PeekBackend)(nil), plain)
+	assert.NotImplements(t, (*yarl.ResetBackend)(nil), plain)
+	assert.NotImplements(t, (*yarl.RefundBackend)(nil), plain)
+
+	full := tel.InstrumentBackend(lrubackend.New(nil, 10))
+	assert.Implements(t, (*yarl.BatchBackend)(nil), full)
+	assert.Implements(t, (*yarl.PeekBackend)(nil), full)
+	assert.Implements(t, (*yarl.ResetBackend)(nil), full)
+	assert.Implements(t, (*yarl.RefundBackend)(nil), full)
+
+	// The limiter sees the wrapped backend's capabilities, not the wrapper's.
+	rules := []yarl.Rule{{ID: "r", TTL: time.Minute, MaxRequests: 1}}
+	peekOnly := struct{ yarl.PeekBackend }{lrubackend.New(rules, 10)}
+	l := yarl.NewWithOptions(tel.InstrumentBackend(peekOnly), rules,
+		yarl.WithBanPolicy(yarl.BanPolicy{Period: time.Minute, Duration: time.Minute}))
+	for range 2 {
+		_, err := l.Check(context.Background(), "alice")
+		require.NoError(t, err)
+	}
+	assert.ErrorIs(t, l.Refund(context.Background(), "alice", nil), yarl.ErrUnsupported)
+	assert.NotEmpty(t, spans.Ended())
+}
+
+func TestInstrumentLeaseBackend(t *testing.T) {
+	tel, spans, _ := newTelemetry(t)
+	c := yarl.NewConcurrency(tel.InstrumentLeaseBackend(lrubackend.New(nil, 10)),
+		yarl.ConcurrencyRule{ID: "c", MaxInFlight: 1, LeaseTTL: time.Minute})
+
+	lease, _, err := c.Acquire(context.Background(), "alice")
+	require.NoError(t, err)
+	require.NotNil(t, lease)
+	require.NoError(t, lease.Release(context.Background()))
+
+	ended := spans.Ended()
+	require.Len(t, ended, 2)
+	assert.Equal(t, "yarl.backend."+OpAcquire, ended[0].Name())
+	assert.Equal(t, "yarl.backend."+OpRelease, ended[1].Name())
+}
+
+func TestTelemetry_Observer(t *testing.T) {
+	tel, spans, reader := newTelemetry(t)
+
+	rules := []yarl.Rule{{ID: "burst", TTL: time.Minute, MaxRequests: 1}}
+	l := yarl.NewWithOptions(lrubackend.New(rules, 10), rules, yarl.WithObserver(tel))
+	for range 2 {
+		_, err := l.Check(context.Background(), "alice")
+		require.NoError(t, err)
+	}
+
+	assert.Empty(t, spans.Ended())
+	assert.Equal(t, map[string]int64{"burst/allowed": 1, "burst/denied": 1}, decisionCounts(t, reader))
+}
@@ -0,0 +1,244 @@
+package yarlprom
+
+import (
+	"context"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+)
+
+// Operation label values of the backend metrics.
+const (
+	OpIncAndGetTTL      = "inc_and_get_ttl"
+	OpIncAndGetTTLBatch = "inc_and_get_ttl_batch"
+	OpGet               = "get"
+	OpReset             = "reset"
+	OpDecrement         = "decrement"
+	OpAcquire           = "acquire"
+	OpRelease           = "release"
+)
+
+// InstrumentBackend wraps b so every call records its latency and errors.
+//
+// The wrapper implements exactly the optional interfaces b implements among
+// [yarl.BatchBackend], [yarl.PeekBackend], [yarl.ResetBackend] and
+// [yarl.RefundBackend], so the Limiter's capability checks see b's own.
+// Instrument the [yarl.LeaseBackend] of a [yarl.ConcurrencyLimiter] with
+// [Metrics.InstrumentLeaseBackend].
+func (m *Metrics) InstrumentBackend(b yarl.Backend) yarl.Backend {
+	base := &backend{next: b, metrics: m}
+	var caps int
+	if _, ok := b.(yarl.BatchBackend); ok {
+		caps |= capBatch
+	}
+	if _, ok := b.(yarl.PeekBackend); ok {
+		caps |= capPeek
+	}
+	if _, ok := b.(yarl.ResetBackend); ok {
+		caps |= capReset
+	}
+	if _, ok := b.(yarl.RefundBackend); ok {
+		caps |= capRefund
+	}
+	return wrappers[caps](base)
+}
+
+// InstrumentLeaseBackend wraps b so every call records its latency and errors.
+func (m *Metrics) InstrumentLeaseBackend(b yarl.LeaseBackend) yarl.LeaseBackend {
+	return &leaseBackend{next: b, metrics: m}
+}
+
+// Optional interfaces of the wrapped backend, as bits indexing wrappers.
+const (
+	capBatch = 1 << iota
+	capPeek
+	capReset
+	capRefund
+)
+
+// wrappers builds, for every combination of optional interfaces, a value
+// exposing the methods of those interfaces and no others. Index with the cap
+// bits of the wrapped backend.
+var wrappers = [16]func(*backend) yarl.Backend{
+	func(b *backend) yarl.Backend { return b },
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+		}{b, batcher{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			peeker
+		}{b, peeker{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			peeker
+		}{b, batcher{b}, peeker{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			resetter
+		}{b, resetter{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			resetter
+		}{b, batcher{b}, resetter{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			peeker
+			resetter
+		}{b, peeker{b}, resetter{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			peeker
+			resetter
+		}{b, batcher{b}, peeker{b}, resetter{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			refunder
+		}{b, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			refunder
+		}{b, batcher{b}, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			peeker
+			refunder
+		}{b, peeker{b}, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			peeker
+			refunder
+		}{b, batcher{b}, peeker{b}, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			resetter
+			refunder
+		}{b, resetter{b}, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			resetter
+			refunder
+		}{b, batcher{b}, resetter{b}, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			peeker
+			resetter
+			refunder
+		}{b, peeker{b}, resetter{b}, refunder{b}}
+	},
+	func(b *backend) yarl.Backend {
+		return struct {
+			*backend
+			batcher
+			peeker
+			resetter
+			refunder
+		}{b, batcher{b}, peeker{b}, resetter{b}, refunder{b}}
+	},
+}
+
+// backend instruments the [yarl.Backend] methods of next.
+type backend struct {
+	next    yarl.Backend
+	metrics *Metrics
+}
+
+func (m *Metrics) observe(op string, start time.Time, err error) {
+	m.backendDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.backendErrors.WithLabelValues(op).Inc()
+	}
+}
+
+// IncAndGetTTL implements [yarl.Backend].
+func (b *backend) IncAndGetTTL(ctx context.Context, key string, ttl time.Duration) (count int64, remaining time.Duration, err error) {
+	defer func(start time.Time) { b.metrics.observe(OpIncAndGetTTL, start, err) }(time.Now())
+	return b.next.IncAndGetTTL(ctx, key, ttl)
+}
+
+// The types below each add the method of one optional interface to backend.
+// The wrappers embed *backend next to them so that IncAndGetTTL is promoted
+// from the shallower, unambiguous field.
+
+type batcher struct{ *backend }
+
+// IncAndGetTTLBatch implements [yarl.BatchBackend].
+func (b batcher) IncAndGetTTLBatch(ctx context.Context, entries []yarl.BatchEntry) (results []yarl.BatchResult, err error) {
+	defer func(start time.Time) { b.metrics.observe(OpIncAndGetTTLBatch, start, err) }(time.Now())
+	return b.next.(yarl.BatchBackend).IncAndGetTTLBatch(ctx, entries)
+}
+
+type peeker struct{ *backend }
+
+// Get implements [yarl.PeekBackend].
+func (b peeker) Get(ctx context.Context, key string) (count int64, remaining time.Duration, err error) {
+	defer func(start time.Time) { b.metrics.observe(OpGet, start, err) }(time.Now())
+	return b.next.(yarl.PeekBackend).Get(ctx, key)
+}
+
+type resetter struct{ *backend }
+
+// Reset implements [yarl.ResetBackend].
+func (b resetter) Reset(ctx context.Context, key string) (err error) {
+	defer func(start time.Time) { b.metrics.observe(OpReset, start, err) }(time.Now())
+	return b.next.(yarl.ResetBackend).Reset(ctx, key)
+}
+
+type refunder struct{ *backend }
+
+// Decrement implements [yarl.RefundBackend].
+func (b refunder) Decrement(ctx context.Context, key string) (err error) {
+	defer func(start time.Time) { b.metrics.observe(OpDecrement, start, err) }(time.Now())
+	return b.next.(yarl.RefundBackend).Decrement(ctx, key)
+}
+
+// leaseBackend instruments a [yarl.LeaseBackend].
+type leaseBackend struct {
+	next    yarl.LeaseBackend
+	metrics *Metrics
+}
+
+// Acquire implements [yarl.LeaseBackend].
+func (b *leaseBackend) Acquire(ctx context.Context, key, leaseID string, max int64, ttl time.Duration) (acquired bool, inFlight int64, oldest time.Duration, err error) {
+	defer func(start time.Time) { b.metrics.observe(OpAcquire, start, err) }(time.Now())
+	return b.next.Acquire(ctx, key, leaseID, max, ttl)
+}
+
+// Release implements [yarl.LeaseBackend].
+func (b *leaseBackend) Release(ctx context.Context, key, leaseID string) (err error) {
+	defer func(start time.Time) { b.metrics.observe(OpRelease, start, err) }(time.Now())
+	return b.next.Release(ctx, key, leaseID)
+}
@@ -0,0 +1,150 @@
+// Package yarlprom exposes Prometheus metrics for YARL.
+//
+// Create a [Metrics] with [New] on your own registry, then:
+//   - wrap the backend with [Metrics.InstrumentBackend] before passing it to
+//     [yarl.New] to record backend latency and errors;
+//   - register the Metrics as a [yarl.Observer] with [yarl.WithObserver], or call
+//     [Metrics.ObserveResults] with the results of every [yarl.Limiter.Check],
+//     to count allowed and denied decisions per rule;
+//   - call [Metrics.RegisterCache] for in-memory backends such as
+//     [lrubackend.LRUBackend] to export their size and evictions.
+//
+// Exported series:
+//
+//	yarl_decisions_total{rule, decision="allowed|denied|would_block"}
+//	yarl_backend_duration_seconds{operation}
+//	yarl_backend_errors_total{operation}
+//	yarl_cache_entries{cache}
+//	yarl_cache_evictions_total{cache}
+package yarlprom
+
+import (
+	"context"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "yarl"
+
+// Decision label values.
+const (
+	DecisionAllowed = "allowed"
+	DecisionDenied  = "denied"
+	// DecisionWouldBlock counts violations of [yarl.Rule.DryRun] rules, which
+	// are reported but not enforced.
+	DecisionWouldBlock = "would_block"
+)
+
+// Metrics holds the YARL collectors registered on one registry.
+// Create one with [New].
+type Metrics struct {
+	reg             prometheus.Registerer
+	decisions       *prometheus.CounterVec
+	backendDuration *prometheus.HistogramVec
+	backendErrors   *prometheus.CounterVec
+}
+
+// New creates the YARL collectors and registers them on reg.
+// It returns an error if any of them is already registered.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		reg: reg,
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "decisions_total",
+			Help:      "Rate-limit decisions per rule.",
+		}, []string{"rule", "decision"}),
+		backendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "backend_duration_seconds",
+			Help:      "Latency of backend operations.",
+			Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"operation"}),
+		backendErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "backend_errors_total",
+			Help:      "Backend operations that returned an error.",
+		}, []string{"operation"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.decisions, m.backendDuration, m.backendErrors} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ObserveResults counts one decision per result, labelled with the rule ID.
+func (m *Metrics) ObserveResults(results []yarl.RuleResult) {
+	for _, res := range results {
+		decision := DecisionAllowed
+		switch {
+		case !res.Allowed:
+			decision = DecisionDenied
+		case res.WouldBlock:
+			decision = DecisionWouldBlock
+		}
+		m.decisions.WithLabelValues(res.ID, decision).Inc()
+	}
+}
+
+// Observe implements [yarl.Observer] by calling [Metrics.ObserveResults].
+// Failed checks are not counted as decisions; see yarl_backend_errors_total.
+func (m *Metrics) Observe(_ context.Context, d yarl.Decision) {
+	m.ObserveResults(d.Results)
+}
+
+// CacheStats is implemented by in-memory backends such as [lrubackend.LRUBackend].
+type CacheStats interface {
+	// Len returns the number of entries currently held.
+	Len() int
+	// Evictions returns how many live entries were dropped because the cache was full.
+	Evictions() uint64
+}
+
+// RegisterCache exports the size and evictions of c, labelled cache=name.
+// If c also reports its estimated memory (Bytes() int64) and the new keys it
+// denied while full (Rejections() uint64), as [lrubackend.LRUBackend] does,
+// those are exported too. Register each cache under a distinct name.
+func (m *Metrics) RegisterCache(name string, c CacheStats) error {
+	labels := prometheus.Labels{"cache": name}
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "cache_entries",
+			Help:        "Entries held by an in-memory backend.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(c.Len()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "cache_evictions_total",
+			Help:        "Live entries dropped by an in-memory backend because it was full.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(c.Evictions()) }),
+	}
+	if b, ok := c.(interface{ Bytes() int64 }); ok {
+		collectors = append(collectors, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "cache_bytes",
+			Help:        "Estimated memory held by an in-memory backend.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(b.Bytes()) }))
+	}
+	if r, ok := c.(interface{ Rejections() uint64 }); ok {
+		collectors = append(collectors, prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "cache_rejections_total",
+			Help:        "New keys denied by an in-memory backend because it was full.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(r.Rejections()) }))
+	}
+
+	for _, col := range collectors {
+		if err := m.reg.Register(col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
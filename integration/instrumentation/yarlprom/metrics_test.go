@@ -0,0 +1,178 @@
+package yarlprom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/integration/backend/lrubackend"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errBackend = errors.New("backend down")
+
+type failingBackend struct{}
+
+func (failingBackend) IncAndGetTTL(context.Context, string, time.Duration) (int64, time.Duration, error) {
+	return 0, 0, errBackend
+}
+
+func TestNew_DuplicateRegistration(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	_, err := New(reg)
+	require.NoError(t, err)
+	_, err = New(reg)
+	assert.Error(t, err)
+}
+
+func TestObserveResults(t *testing.T) {
+	m, err := New(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	rules := []yarl.Rule{{ID: "burst", MaxRequests: 1, TTL: time.Minute}}
+	l := yarl.New(m.InstrumentBackend(lrubackend.New(rules, 10)), rules...)
+
+	for range 3 {
+		results, err := l.Check(context.Background(), "alice")
+		require.NoError(t, err)
+		m.ObserveResults(results)
+	}
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.decisions.WithLabelValues("burst", DecisionAllowed)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.decisions.WithLabelValues("burst", DecisionDenied)))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.backendDuration), "one operation label expected")
+	assert.Equal(t, 0, testutil.CollectAndCount(m.backendErrors))
+}
+
+func TestInstrumentBackend_Errors(t *testing.T) {
+	m, err := New(prometheus.NewRegistry())
+	require.NoError(t, err)
+	b := m.InstrumentBackend(failingBackend{})
+
+	_, _, err = b.IncAndGetTTL(context.Background(), "r:k", time.Second)
+	require.ErrorIs(t, err, errBackend)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.backendErrors.WithLabelValues(OpIncAndGetTTL)))
+}
+
+func TestInstrumentBackend_Capabilities(t *testing.T) {
+	m, err := New(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	plain := m.InstrumentBackend(failingBackend{})
+	assert.NotImplements(t, (*yarl.BatchBackend)(nil), plain)
+	assert.NotImplements(t, (*yarl.PeekBackend)(nil), plain)
+	assert.NotImplements(t, (*yarl.ResetBackend)(nil), plain)
+	assert.NotImplements(t, (*yarl.RefundBackend)(nil), plain)
+
+	full := m.InstrumentBackend(lrubackend.New(nil, 10))
+	assert.Implements(t, (*yarl.BatchBackend)(nil), full)
+	assert.Implements(t, (*yarl.PeekBackend)(nil), full)
+	assert.Implements(t, (*yarl.ResetBackend)(nil), full)
+	assert.Implements(t, (*yarl.RefundBackend)(nil), full)
+
+	// The limiter sees the wrapped backend's capabilities, not the wrapper's.
+	rules := []yarl.Rule{{ID: "r", TTL: time.Minute, MaxRequests: 1}}
+	peekOnly := struct{ yarl.PeekBackend }{lrubackend.New(rules, 10)}
+	l := yarl.NewWithOptions(m.InstrumentBackend(peekOnly), rules,
+		yarl.WithBanPolicy(yarl.BanPolicy{Period: time.Minute, Duration: time.Minute}))
+	for range 2 {
+		_, err := l.Check(context.Background(), "alice")
+		require.NoError(t, err)
+	}
+	assert.ErrorIs(t, l.Refund(context.Background(), "alice", nil), yarl.ErrUnsupported)
+}
+
+func TestInstrumentLeaseBackend(t *testing.T) {
+	m, err := New(prometheus.NewRegistry())
+	require.NoError(t, err)
+	c := yarl.NewConcurrency(m.InstrumentLeaseBackend(lrubackend.New(nil, 10)),
+		yarl.ConcurrencyRule{ID: "c", MaxInFlight: 1, LeaseTTL: time.Minute})
+
+	lease, _, err := c.Acquire(context.Background(), "alice")
+	require.NoError(t, err)
+	require.NotNil(t, lease)
+	require.NoError(t, lease.Release(context.Background()))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.backendDuration), "acquire and release")
+}
+
+func TestRegisterCache(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg)
+	require.NoError(t, err)
+
+	rules := []yarl.Rule{{ID: "r", MaxRequests: 10, TTL: time.Minute}}
+	lru := lrubackend.New(rules, 2)
+	require.NoError(t, m.RegisterCache("api", lru))
+	assert.Error(t, m.RegisterCache("api", lru), "names must be unique")
+
+	for _, k := range []string{"a", "b", "c"} {
+		_, _, err := lru.IncAndGetTTL(context.Background(), "r:"+k, time.Minute)
+		require.NoError(t, err)
+	}
+
+	expected := `
+# HELP yarl_cache_entries Entries held by an in-memory backend.
+# TYPE yarl_cache_entries gauge
+yarl_cache_entries{cache="api"} 2
+# HELP yarl_cache_evictions_total Live entries dropped by an in-memory backend because it was full.
+# TYPE yarl_cache_evictions_total counter
+yarl_cache_evictions_total{cache="api"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "yarl_cache_entries", "yarl_cache_evictions_total"))
+}
+
+func TestRegisterCache_BytesAndRejections(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := New(reg)
+	require.NoError(t, err)
+
+	lru := lrubackend.New(nil, 1, lrubackend.WithRejectWhenFull())
+	require.NoError(t, m.RegisterCache("api", lru))
+	for _, k := range []string{"a", "b"} {
+		_, _, err := lru.IncAndGetTTL(context.Background(), "r:"+k, time.Minute)
+		require.NoError(t, err)
+	}
+
+	expected := fmt.Sprintf(`
+# HELP yarl_cache_bytes Estimated memory held by an in-memory backend.
+# TYPE yarl_cache_bytes gauge
+yarl_cache_bytes{cache="api"} %d
+# HELP yarl_cache_rejections_total New keys denied by an in-memory backend because it was full.
+# TYPE yarl_cache_rejections_total counter
+yarl_cache_rejections_total{cache="api"} 1
+`, lru.Bytes())
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "yarl_cache_bytes", "yarl_cache_rejections_total"))
+	assert.Positive(t, lru.Bytes())
+}
+
+func TestMetrics_Observer(t *testing.T) {
+	m, err := New(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	rules := []yarl.Rule{{ID: "burst", MaxRequests: 1, TTL: time.Minute}}
+	l := yarl.NewWithOptions(lrubackend.New(rules, 10), rules, yarl.WithObserver(m))
+	for range 2 {
+		_, err := l.Check(context.Background(), "alice")
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.decisions.WithLabelValues("burst", DecisionAllowed)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.decisions.WithLabelValues("burst", DecisionDenied)))
+}
+
+func TestObserveResults_DryRun(t *testing.T) {
+	m, err := New(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	m.ObserveResults([]yarl.RuleResult{{ID: "shadow", Allowed: true, WouldBlock: true}})
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.decisions.WithLabelValues("shadow", DecisionWouldBlock)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.decisions.WithLabelValues("shadow", DecisionAllowed)))
+}
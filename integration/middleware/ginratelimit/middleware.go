@@ -2,17 +2,22 @@
 //
 // Register the handler returned by [New] with router.Use() to enforce rate limits.
 // When a request violates any rule the middleware aborts with HTTP 429 and a JSON
-// body listing each violated rule with its retry window.
+// body listing each violated rule with its retry window. Set
+// [Configuration.OnLimited] and [Configuration.OnError] to customise the responses,
+// e.g. with the RFC 9457 or content-negotiated handlers of package [response].
 package ginratelimit
 
 import (
-	"encoding/json"
-	"net/http"
+	"context"
+	"errors"
+	"log/slog"
+	"net/netip"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/integration/middleware/response"
 )
 
 // Configuration holds middleware settings.
@@ -20,57 +25,242 @@ import (
 type Configuration struct {
 	limiter *yarl.Limiter
 	// UseIP includes the client IP (from c.ClientIP()) in the rate-limit key.
+	// Restrict the engine with [gin.Engine.SetTrustedProxies], or clients can
+	// pick their key through X-Forwarded-For.
 	UseIP bool
 	// Headers lists request header names appended to the key (e.g. "X-Tenant-ID").
 	Headers []string
+	// Check, when set, replaces the call to [yarl.Limiter.Check] on the limiter
+	// passed to NewConfiguration, which it must still check, e.g. to wrap every
+	// decision in a span with yarlotel's Telemetry.CheckFunc.
+	Check func(ctx context.Context, key string) ([]yarl.RuleResult, error)
+	// OnLimited writes the response when a request violates any rule; the
+	// middleware aborts the chain afterwards. Defaults to [response.Violations].
+	OnLimited response.LimitedHandler
+	// OnError writes the response when the limiter fails; the middleware aborts
+	// the chain afterwards. Defaults to [response.InternalError] (a bare HTTP 500).
+	OnError response.ErrorHandler
+	// Concurrency, when set, caps in-flight requests per key: a lease is acquired
+	// after the rate rules pass and released when the rest of the chain returns.
+	// Requests that find no free slot are rejected through OnLimited.
+	Concurrency *yarl.ConcurrencyLimiter
+	// Access, when set, is matched against the key, the client IP (see ClientIP)
+	// and the request headers before anything else: allowlisted requests skip all
+	// limits and denylisted ones are rejected through OnDenied, which aborts the
+	// chain. Entries can be changed at runtime with [yarl.AccessList.Update].
+	// Header entries match values the client chooses, such as a User-Agent,
+	// unless a trusted proxy sets them.
+	Access *yarl.AccessList
+	// ClientIP returns the address the CIDR entries of Access, and of the
+	// limiter's [yarl.WithAccessList], are matched against.
+	// Defaults to c.RemoteIP(), the connection's peer, which a client cannot
+	// forge. c.ClientIP() is not the default: gin trusts X-Forwarded-For from
+	// every peer unless [gin.Engine.SetTrustedProxies] restricts it, which would
+	// let a client claim an allowlisted address and skip every limit. Once the
+	// engine's trusted proxies are set, use [ClientIP].
+	ClientIP func(c *gin.Context) netip.Addr
+	// OnDenied writes the response for denylisted requests, including those the
+	// limiter rejects with [yarl.ErrDenied]. Defaults to [response.Forbidden].
+	OnDenied response.ErrorHandler
+	// Logger, when set, logs limiter failures at Error level, and at Info level the
+	// rejected requests and those only a [yarl.Rule.DryRun] rule would reject, with
+	// the request method and route. Do not also pass it to the
+	// limiter with [yarl.WithLogger], or every event is logged twice.
+	Logger *slog.Logger
+	// LogOptions configures denial sampling and key hashing for Logger.
+	LogOptions yarl.LogOptions
+
+	logOnce sync.Once
+	log     *yarl.DecisionLogger
 }
 
 // NewConfiguration creates a Configuration backed by limiter.
+// limiter may be nil when only [Configuration.Concurrency] is used.
 func NewConfiguration(limiter *yarl.Limiter) *Configuration {
 	return &Configuration{limiter: limiter}
 }
 
+// ResultsKey is the gin.Context key under which the middleware stores the
+// []yarl.RuleResult of the current request.
+const ResultsKey = "yarl.results"
+
 // New returns a gin.HandlerFunc that enforces rate limits defined by conf.
 // Requests that violate any rule are aborted with HTTP 429 before c.Next() is called.
+// The per-rule results are stored under [ResultsKey] and in the request context;
+// read them with [Results] or [yarl.FromContext].
 func New(conf *Configuration) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		key := buildKey(c, conf)
+		switch conf.access(c, key) {
+		case yarl.AccessDeny:
+			conf.deny(c, key)
+			c.Abort()
+			return
+		case yarl.AccessAllow:
+			c.Next()
+			return
+		}
+
+		var results []yarl.RuleResult
+		if conf.limiter != nil {
+			var err error
+			results, err = conf.check(c, key)
+			if err != nil {
+				conf.fail(c, key, err)
+				c.Abort()
+				return
+			}
+			setResults(c, results)
+
+			if allowed, _ := yarl.Summarize(results); !allowed {
+				conf.limit(c, key, results)
+				c.Abort()
+				return
+			}
+			conf.logger().LogDenied(c.Request.Context(), key, results, requestAttrs(c)...) // dry-run rules only
+		}
+
+		if conf.Concurrency == nil {
+			c.Next()
+			return
+		}
 
-		results, err := conf.limiter.Check(c.Request.Context(), key)
+		lease, leaseResults, err := conf.Concurrency.Acquire(c.Request.Context(), key)
 		if err != nil {
-			c.AbortWithStatus(http.StatusInternalServerError)
+			conf.fail(c, key, err)
+			c.Abort()
 			return
 		}
+		results = append(results[:len(results):len(results)], leaseResults...)
+		setResults(c, results)
 
-		if violations := collectViolations(results); len(violations) > 0 {
-			c.Header("Content-Type", "application/json")
-			body, _ := json.Marshal(map[string]any{"violations": violations})
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, json.RawMessage(body))
+		if lease == nil {
+			conf.limit(c, key, results)
+			c.Abort()
 			return
 		}
+		// Release even if the client went away or a later handler panics. A lease
+		// that fails to release holds its slot until LeaseTTL, so the failure is logged.
+		defer func() {
+			ctx := context.WithoutCancel(c.Request.Context())
+			if err := lease.Release(ctx); err != nil {
+				conf.logger().LogError(ctx, key, err, requestAttrs(c)...)
+			}
+		}()
 
 		c.Next()
 	}
 }
 
-type violationDTO struct {
-	ID                string    `json:"id"`
-	RetryAfterSeconds int64     `json:"retry_after_seconds"`
-	ResetsAt          time.Time `json:"resets_at"`
+// check runs Check, or the limiter's Check when it is not set, with the client
+// IP in the context for the limiter's access list.
+func (conf *Configuration) check(c *gin.Context, key string) ([]yarl.RuleResult, error) {
+	ctx := yarl.NewClientIPContext(c.Request.Context(), conf.clientIP(c))
+	if conf.Check != nil {
+		return conf.Check(ctx, key)
+	}
+	return conf.limiter.Check(ctx, key)
+}
+
+func setResults(c *gin.Context, results []yarl.RuleResult) {
+	c.Set(ResultsKey, results)
+	c.Request = c.Request.WithContext(yarl.NewContext(c.Request.Context(), results))
+}
+
+// limit rejects c through OnLimited, logging the denial.
+func (conf *Configuration) limit(c *gin.Context, key string, results []yarl.RuleResult) {
+	conf.logger().LogDenied(c.Request.Context(), key, results, requestAttrs(c)...)
+	conf.onLimited()(c.Writer, c.Request, results)
+}
+
+// fail answers c through OnError, logging err. Denylisted keys reported by the
+// limiter are answered through OnDenied instead.
+func (conf *Configuration) fail(c *gin.Context, key string, err error) {
+	if errors.Is(err, yarl.ErrDenied) {
+		conf.deny(c, key)
+		return
+	}
+	conf.logger().LogError(c.Request.Context(), key, err, requestAttrs(c)...)
+	conf.onError()(c.Writer, c.Request, err)
+}
+
+// deny rejects a denylisted request through OnDenied.
+func (conf *Configuration) deny(c *gin.Context, key string) {
+	conf.logger().LogDenylisted(c.Request.Context(), key, requestAttrs(c)...)
+	if conf.OnDenied != nil {
+		conf.OnDenied(c.Writer, c.Request, yarl.ErrDenied)
+		return
+	}
+	response.Forbidden(c.Writer, c.Request, yarl.ErrDenied)
 }
 
-func collectViolations(results []yarl.RuleResult) []violationDTO {
-	var out []violationDTO
-	for _, res := range results {
-		if !res.Allowed {
-			out = append(out, violationDTO{
-				ID:                res.ID,
-				RetryAfterSeconds: int64(res.RetryAfter / time.Second),
-				ResetsAt:          res.ExpiresAt,
-			})
+// logger returns the DecisionLogger built from Logger on first use, or nil.
+func (conf *Configuration) logger() *yarl.DecisionLogger {
+	conf.logOnce.Do(func() {
+		if conf.Logger != nil {
+			conf.log = yarl.NewDecisionLogger(conf.Logger, conf.LogOptions)
 		}
+	})
+	return conf.log
+}
+
+func requestAttrs(c *gin.Context) []slog.Attr {
+	return []slog.Attr{slog.String("method", c.Request.Method), slog.String("route", c.FullPath())}
+}
+
+func (conf *Configuration) onLimited() response.LimitedHandler {
+	if conf.OnLimited != nil {
+		return conf.OnLimited
+	}
+	return response.Violations
+}
+
+func (conf *Configuration) onError() response.ErrorHandler {
+	if conf.OnError != nil {
+		return conf.OnError
+	}
+	return response.InternalError
+}
+
+// Results returns the per-rule results computed by the middleware for c.
+// ok is false when c did not pass through the middleware.
+func Results(c *gin.Context) (results []yarl.RuleResult, ok bool) {
+	v, exists := c.Get(ResultsKey)
+	if !exists {
+		return nil, false
 	}
-	return out
+	results, ok = v.([]yarl.RuleResult)
+	return results, ok
+}
+
+// access matches c against conf.Access.
+func (conf *Configuration) access(c *gin.Context, key string) yarl.Access {
+	if conf.Access == nil {
+		return yarl.AccessDefault
+	}
+	return conf.Access.Match(yarl.AccessSubject{Key: key, IP: conf.clientIP(c), Header: c.GetHeader})
+}
+
+// clientIP returns the address of c from ClientIP, or from [RemoteIP] when unset.
+func (conf *Configuration) clientIP(c *gin.Context) netip.Addr {
+	if conf.ClientIP != nil {
+		return conf.ClientIP(c)
+	}
+	return RemoteIP(c)
+}
+
+// RemoteIP returns the address of c's peer, or the zero Addr if it cannot be
+// parsed. It is the default [Configuration.ClientIP].
+func RemoteIP(c *gin.Context) netip.Addr {
+	addr, _ := netip.ParseAddr(c.RemoteIP())
+	return addr.Unmap()
+}
+
+// ClientIP returns c.ClientIP() as a [Configuration.ClientIP]. Use it only
+// after restricting the engine with [gin.Engine.SetTrustedProxies].
+func ClientIP(c *gin.Context) netip.Addr {
+	addr, _ := netip.ParseAddr(c.ClientIP())
+	return addr.Unmap()
 }
 
 func buildKey(c *gin.Context, conf *Configuration) string {
@@ -1,8 +1,11 @@
 package ginratelimit
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"sync"
@@ -11,7 +14,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/integration/middleware/response"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type stubBackend struct {
@@ -97,6 +102,251 @@ func TestGinMiddleware_BackendError_Returns500(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
+func TestGinMiddleware_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	conf := NewConfiguration(newLimiter(1, 30*time.Second, nil))
+	conf.Headers = []string{"X-User-ID"}
+	conf.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	r := newRouter(conf)
+	doRequest(r, map[string]string{"X-User-ID": "alice"})
+	assert.Empty(t, buf.String(), "allowed requests are not logged")
+
+	doRequest(r, map[string]string{"X-User-ID": "alice"})
+	assert.Contains(t, buf.String(), `level=INFO msg="yarl: request throttled" key=:alice rule=test retry_after=30s`)
+	assert.Contains(t, buf.String(), "method=GET route=/")
+}
+
+func TestGinMiddleware_Access(t *testing.T) {
+	access, err := yarl.NewAccessList(yarl.AccessRules{
+		AllowKeys: []string{":healthcheck"},
+		DenyKeys:  []string{":abuser"},
+	})
+	require.NoError(t, err)
+
+	backend := newStubBackend(time.Minute, nil)
+	conf := NewConfiguration(yarl.New(backend, yarl.Rule{ID: "test", TTL: time.Minute, MaxRequests: 1}))
+	conf.Headers = []string{"X-User-ID"}
+	conf.Access = access
+	r := newRouter(conf)
+
+	for range 3 {
+		assert.Equal(t, http.StatusOK, doRequest(r, map[string]string{"X-User-ID": "healthcheck"}).Code)
+	}
+	assert.Empty(t, backend.counts, "allowlisted requests must not reach the backend")
+	assert.Equal(t, http.StatusForbidden, doRequest(r, map[string]string{"X-User-ID": "abuser"}).Code)
+	assert.Equal(t, http.StatusOK, doRequest(r, map[string]string{"X-User-ID": "alice"}).Code)
+}
+
+func TestGinMiddleware_Access_CIDR(t *testing.T) {
+	access, err := yarl.NewAccessList(yarl.AccessRules{AllowCIDRs: []string{"10.0.0.0/8"}})
+	require.NoError(t, err)
+
+	conf := NewConfiguration(newLimiter(1, time.Minute, nil))
+	conf.Access = access
+	r := newRouter(conf)
+
+	do := func(remoteAddr string, headers map[string]string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for range 3 {
+		assert.Equal(t, http.StatusOK, do("10.1.2.3:4567", nil))
+	}
+
+	spoofed := map[string]string{"X-Forwarded-For": "10.1.2.3"}
+	assert.Equal(t, http.StatusOK, do("203.0.113.1:4567", spoofed))
+	assert.Equal(t, http.StatusTooManyRequests, do("203.0.113.1:4567", spoofed),
+		"a client-supplied X-Forwarded-For must not reach the allowlist")
+}
+
+func TestGinMiddleware_LimiterAccessList_IgnoresSpoofedForwardedFor(t *testing.T) {
+	access, err := yarl.NewAccessList(yarl.AccessRules{AllowCIDRs: []string{"10.0.0.0/8"}})
+	require.NoError(t, err)
+
+	l := yarl.NewWithOptions(newStubBackend(time.Minute, nil),
+		[]yarl.Rule{{ID: "test", TTL: time.Minute, MaxRequests: 1}}, yarl.WithAccessList(access))
+	conf := NewConfiguration(l)
+	conf.UseIP = true // c.ClientIP() trusts X-Forwarded-For by default
+	r := newRouter(conf)
+
+	do := func(remoteAddr string, headers map[string]string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	spoofed := map[string]string{"X-Forwarded-For": "10.1.2.3"}
+	assert.Equal(t, http.StatusOK, do("203.0.113.1:4567", spoofed))
+	assert.Equal(t, http.StatusTooManyRequests, do("203.0.113.1:4567", spoofed),
+		"a key taken from X-Forwarded-For must not match the allowlist")
+	for range 3 {
+		assert.Equal(t, http.StatusOK, do("10.1.2.3:4567", nil))
+	}
+}
+
+func TestGinMiddleware_BlockedRequest_ViolationsBody(t *testing.T) {
+	conf := NewConfiguration(newLimiter(0, 30*time.Second, nil))
+
+	w := doRequest(newRouter(conf), nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, response.ContentTypeJSON, w.Header().Get("Content-Type"))
+
+	var body map[string][]response.Violation
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body["violations"], 1)
+	assert.Equal(t, "test", body["violations"][0].ID)
+}
+
+func TestGinMiddleware_OnLimited_Negotiate(t *testing.T) {
+	conf := NewConfiguration(newLimiter(0, 30*time.Second, nil))
+	conf.OnLimited = response.Negotiate
+
+	w := doRequest(newRouter(conf), map[string]string{"Accept": "text/plain"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, response.ContentTypeText, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "test: retry after 30s")
+}
+
+func TestGinMiddleware_OnError(t *testing.T) {
+	conf := NewConfiguration(newLimiter(10, 0, errors.New("storage down")))
+	conf.OnError = response.ProblemError
+
+	w := doRequest(newRouter(conf), nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, response.ContentTypeProblem, w.Header().Get("Content-Type"))
+}
+
+func TestGinMiddleware_ResultsInContext(t *testing.T) {
+	conf := NewConfiguration(newLimiter(5, time.Minute, nil))
+
+	var fromKeys, fromRequest []yarl.RuleResult
+	var okKeys, okRequest bool
+	r := gin.New()
+	r.Use(New(conf))
+	r.GET("/", func(c *gin.Context) {
+		fromKeys, okKeys = Results(c)
+		fromRequest, okRequest = yarl.FromContext(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	doRequest(r, nil)
+	require.True(t, okKeys)
+	require.True(t, okRequest)
+	require.Len(t, fromKeys, 1)
+	assert.Equal(t, fromKeys, fromRequest)
+	assert.Equal(t, int64(4), fromKeys[0].Remaining())
+}
+
+// stubLeaseBackend counts leases per key and ignores expiry.
+type stubLeaseBackend struct {
+	mu         sync.Mutex
+	held       map[string]int64
+	releaseErr error
+}
+
+func (s *stubLeaseBackend) Acquire(_ context.Context, key, _ string, max int64, ttl time.Duration) (bool, int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.held == nil {
+		s.held = make(map[string]int64)
+	}
+	if s.held[key] >= max {
+		return false, s.held[key], ttl, nil
+	}
+	s.held[key]++
+	return true, s.held[key], ttl, nil
+}
+
+func (s *stubLeaseBackend) Release(_ context.Context, key, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.releaseErr != nil {
+		return s.releaseErr
+	}
+	s.held[key]--
+	return nil
+}
+
+func TestGinMiddleware_Concurrency(t *testing.T) {
+	leases := &stubLeaseBackend{}
+	conf := NewConfiguration(nil)
+	conf.Concurrency = yarl.NewConcurrency(leases, yarl.ConcurrencyRule{ID: "exports", MaxInFlight: 1, LeaseTTL: time.Minute})
+
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	r := gin.New()
+	r.Use(New(conf))
+	r.GET("/slow", func(c *gin.Context) {
+		close(entered)
+		<-unblock
+		c.Status(http.StatusOK)
+	})
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		done <- w.Code
+	}()
+	<-entered
+
+	w := doRequest(r, nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "second in-flight request must be rejected")
+
+	close(unblock)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, int64(0), leases.held["exports:"], "lease must be released after the chain returns")
+
+	w = doRequest(r, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGinMiddleware_Concurrency_LogsReleaseError(t *testing.T) {
+	var buf bytes.Buffer
+	leases := &stubLeaseBackend{releaseErr: errors.New("storage down")}
+	conf := NewConfiguration(nil)
+	conf.Concurrency = yarl.NewConcurrency(leases, yarl.ConcurrencyRule{ID: "c", MaxInFlight: 1, LeaseTTL: time.Minute})
+	conf.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	w := doRequest(newRouter(conf), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, buf.String(), "level=ERROR")
+	assert.Contains(t, buf.String(), `error="storage down"`)
+	assert.Contains(t, buf.String(), "method=GET route=/")
+}
+
+func TestGinMiddleware_CheckHook(t *testing.T) {
+	l := newLimiter(1, time.Minute, nil)
+	var keys []string
+	conf := NewConfiguration(l)
+	conf.Headers = []string{"X-User-ID"}
+	conf.Check = func(ctx context.Context, key string) ([]yarl.RuleResult, error) {
+		keys = append(keys, key)
+		return l.Check(ctx, key)
+	}
+	r := newRouter(conf)
+
+	assert.Equal(t, http.StatusOK, doRequest(r, map[string]string{"X-User-ID": "alice"}).Code)
+	assert.Equal(t, http.StatusTooManyRequests, doRequest(r, map[string]string{"X-User-ID": "alice"}).Code)
+	assert.Equal(t, []string{":alice", ":alice"}, keys)
+}
+
 func TestGinMiddleware_UseHeader(t *testing.T) {
 	backend := newStubBackend(time.Minute, nil)
 	limiter := yarl.New(backend, yarl.Rule{ID: "api", TTL: time.Minute, MaxRequests: 2})
@@ -0,0 +1,202 @@
+// Package grpcratelimit provides rate-limiting interceptors for gRPC servers.
+//
+// Install the interceptors returned by [UnaryServerInterceptor] and
+// [StreamServerInterceptor] with grpc.ChainUnaryInterceptor and
+// grpc.ChainStreamInterceptor. The rate-limit key is built from the peer
+// address, incoming metadata values and the full method name, as enabled on
+// the [Configuration].
+//
+// When a call violates any rule the interceptor fails it with
+// codes.ResourceExhausted; the status carries a RetryInfo detail with the
+// longest retry delay and a QuotaFailure detail listing each violated rule.
+// Every call receives ratelimit-limit, ratelimit-remaining and ratelimit-reset
+// trailers describing the rule closest to its limit. Calls whose key the
+// limiter denylists fail with codes.PermissionDenied.
+package grpcratelimit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Trailer keys set on every rate-limited call.
+const (
+	TrailerLimit     = "ratelimit-limit"
+	TrailerRemaining = "ratelimit-remaining"
+	TrailerReset     = "ratelimit-reset"
+)
+
+// Configuration holds interceptor settings.
+// Create one with [NewConfiguration], then set UsePeer, Metadata and UseMethod as needed.
+type Configuration struct {
+	limiter *yarl.Limiter
+	// UsePeer includes the peer IP address in the rate-limit key.
+	UsePeer bool
+	// Metadata lists incoming metadata keys appended to the key (e.g. "x-user-id").
+	Metadata []string
+	// UseMethod appends the full method name (e.g. "/pkg.Service/Method") to the key,
+	// giving every method its own bucket.
+	UseMethod bool
+	// Check, when set, replaces the call to [yarl.Limiter.Check] on the limiter
+	// passed to NewConfiguration, which it must still check, e.g. to wrap every
+	// decision in a span with yarlotel's Telemetry.CheckFunc.
+	Check func(ctx context.Context, key string) ([]yarl.RuleResult, error)
+}
+
+// NewConfiguration creates a Configuration backed by limiter.
+func NewConfiguration(limiter *yarl.Limiter) *Configuration {
+	return &Configuration{limiter: limiter}
+}
+
+// UnaryServerInterceptor returns a unary interceptor enforcing the rate limits
+// defined by conf. Calls that violate any rule fail with codes.ResourceExhausted
+// before handler is invoked. Allowed calls reach handler with the per-rule
+// results in their context; read them with [yarl.FromContext].
+func UnaryServerInterceptor(conf *Configuration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		results, err := conf.check(ctx, info.FullMethod)
+		if len(results) > 0 {
+			_ = grpc.SetTrailer(ctx, trailer(results))
+		}
+		if err != nil {
+			return nil, err
+		}
+		return handler(yarl.NewContext(ctx, results), req)
+	}
+}
+
+// StreamServerInterceptor returns a stream interceptor enforcing the rate limits
+// defined by conf. The limiter is checked once when the stream opens; streams
+// that violate any rule fail with codes.ResourceExhausted before handler is
+// invoked. The stream context of allowed calls carries the per-rule results.
+func StreamServerInterceptor(conf *Configuration) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		results, err := conf.check(ss.Context(), info.FullMethod)
+		if len(results) > 0 {
+			ss.SetTrailer(trailer(results))
+		}
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: yarl.NewContext(ss.Context(), results)})
+	}
+}
+
+// check runs the limiter and converts a violation or a limiter failure into a gRPC status error.
+// Keys denylisted with [yarl.WithAccessList] fail with codes.PermissionDenied;
+// the peer address is passed to its CIDR entries.
+func (conf *Configuration) check(ctx context.Context, fullMethod string) ([]yarl.RuleResult, error) {
+	check := conf.limiter.Check
+	if conf.Check != nil {
+		check = conf.Check
+	}
+	key := buildKey(ctx, fullMethod, conf)
+	if ip, err := netip.ParseAddr(getPeerIP(ctx)); err == nil {
+		ctx = yarl.NewClientIPContext(ctx, ip.Unmap())
+	}
+	results, err := check(ctx, key)
+	if errors.Is(err, yarl.ErrDenied) {
+		return nil, status.Error(codes.PermissionDenied, "access denied")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "rate limiter unavailable")
+	}
+	if allowed, _ := yarl.Summarize(results); !allowed {
+		return results, limitedError(results)
+	}
+	return results, nil
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// limitedError builds the codes.ResourceExhausted status for a rejected call.
+func limitedError(results []yarl.RuleResult) error {
+	var longest time.Duration
+	quota := &errdetails.QuotaFailure{}
+	for _, res := range results {
+		if res.Allowed {
+			continue
+		}
+		longest = max(longest, res.RetryAfter)
+		quota.Violations = append(quota.Violations, &errdetails.QuotaFailure_Violation{
+			Subject:     res.ID,
+			Description: "limit of " + strconv.FormatInt(res.Max, 10) + " requests exceeded",
+		})
+	}
+
+	st := status.New(codes.ResourceExhausted, "rate limit exceeded")
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(longest)}, quota); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// trailer describes the rule with the fewest remaining requests.
+func trailer(results []yarl.RuleResult) metadata.MD {
+	tightest := results[0]
+	for _, res := range results[1:] {
+		if res.Remaining() < tightest.Remaining() {
+			tightest = res
+		}
+	}
+	reset := max(time.Until(tightest.ExpiresAt), tightest.RetryAfter)
+	return metadata.Pairs(
+		TrailerLimit, strconv.FormatInt(tightest.Max, 10),
+		TrailerRemaining, strconv.FormatInt(tightest.Remaining(), 10),
+		TrailerReset, strconv.FormatInt(int64((reset+time.Second-1)/time.Second), 10),
+	)
+}
+
+func buildKey(ctx context.Context, fullMethod string, conf *Configuration) string {
+	var sb strings.Builder
+	if conf.UsePeer {
+		sb.WriteString(getPeerIP(ctx))
+	}
+	if len(conf.Metadata) > 0 {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, k := range conf.Metadata {
+			sb.WriteByte(':')
+			sb.WriteString(strings.ToLower(strings.Join(md.Get(k), ",")))
+		}
+	}
+	if conf.UseMethod {
+		sb.WriteByte(':')
+		sb.WriteString(fullMethod)
+	}
+	return sb.String()
+}
+
+// getPeerIP extracts the peer IP from ctx, falling back to the raw peer address.
+func getPeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
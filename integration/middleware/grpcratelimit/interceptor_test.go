@@ -0,0 +1,289 @@
+package grpcratelimit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type stubBackend struct {
+	mu        sync.Mutex
+	counts    map[string]int64
+	remaining time.Duration
+	err       error
+}
+
+func newStubBackend(remaining time.Duration, err error) *stubBackend {
+	return &stubBackend{counts: make(map[string]int64), remaining: remaining, err: err}
+}
+
+func (s *stubBackend) IncAndGetTTL(_ context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	if s.err != nil {
+		return 0, 0, s.err
+	}
+	s.mu.Lock()
+	s.counts[key]++
+	count := s.counts[key]
+	s.mu.Unlock()
+	rem := s.remaining
+	if rem == 0 {
+		rem = ttl
+	}
+	return count, rem, nil
+}
+
+func newLimiter(max int64, remaining time.Duration, err error) *yarl.Limiter {
+	return yarl.New(
+		newStubBackend(remaining, err),
+		yarl.Rule{ID: "test", TTL: time.Minute, MaxRequests: max},
+	)
+}
+
+// resultsHealthServer records the results each call found in its context.
+type resultsHealthServer struct {
+	*health.Server
+	mu      sync.Mutex
+	results []yarl.RuleResult
+}
+
+func (s *resultsHealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	s.mu.Lock()
+	s.results, _ = yarl.FromContext(ctx)
+	s.mu.Unlock()
+	return s.Server.Check(ctx, req)
+}
+
+func (s *resultsHealthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	s.mu.Lock()
+	s.results, _ = yarl.FromContext(stream.Context())
+	s.mu.Unlock()
+	return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+}
+
+func (s *resultsHealthServer) lastResults() []yarl.RuleResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.results
+}
+
+// newClient starts a bufconn gRPC server with the interceptors installed and
+// returns a health client connected to it.
+func newClient(t *testing.T, conf *Configuration) (healthpb.HealthClient, *resultsHealthServer) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(UnaryServerInterceptor(conf)),
+		grpc.ChainStreamInterceptor(StreamServerInterceptor(conf)),
+	)
+	hs := &resultsHealthServer{Server: health.NewServer()}
+	healthpb.RegisterHealthServer(srv, hs)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return healthpb.NewHealthClient(conn), hs
+}
+
+func TestUnaryInterceptor_AllowedCall(t *testing.T) {
+	client, hs := newClient(t, NewConfiguration(newLimiter(10, time.Minute, nil)))
+
+	var trailer metadata.MD
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.Trailer(&trailer))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"10"}, trailer.Get(TrailerLimit))
+	assert.Equal(t, []string{"9"}, trailer.Get(TrailerRemaining))
+	assert.Equal(t, []string{"60"}, trailer.Get(TrailerReset))
+
+	results := hs.lastResults()
+	require.Len(t, results, 1)
+	assert.Equal(t, int64(1), results[0].Current)
+}
+
+func TestUnaryInterceptor_BlockedCall_ResourceExhausted(t *testing.T) {
+	client, _ := newClient(t, NewConfiguration(newLimiter(1, 30*time.Second, nil)))
+	ctx := context.Background()
+
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	var trailer metadata.MD
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Trailer(&trailer))
+	require.Error(t, err)
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+
+	var retry *errdetails.RetryInfo
+	var quota *errdetails.QuotaFailure
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.RetryInfo:
+			retry = d
+		case *errdetails.QuotaFailure:
+			quota = d
+		}
+	}
+	require.NotNil(t, retry)
+	assert.Equal(t, 30*time.Second, retry.GetRetryDelay().AsDuration())
+	require.NotNil(t, quota)
+	require.Len(t, quota.GetViolations(), 1)
+	assert.Equal(t, "test", quota.GetViolations()[0].GetSubject())
+
+	assert.Equal(t, []string{"0"}, trailer.Get(TrailerRemaining))
+	assert.Equal(t, []string{"30"}, trailer.Get(TrailerReset))
+}
+
+func TestUnaryInterceptor_BackendError_Internal(t *testing.T) {
+	client, _ := newClient(t, NewConfiguration(newLimiter(10, 0, errors.New("storage down"))))
+
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	st := status.Convert(err)
+	assert.Equal(t, codes.Internal, st.Code())
+	assert.NotContains(t, st.Message(), "storage down", "backend errors must not leak to clients")
+}
+
+func TestUnaryInterceptor_Denylisted_PermissionDenied(t *testing.T) {
+	access, err := yarl.NewAccessList(yarl.AccessRules{DenyKeys: []string{":abuser"}})
+	require.NoError(t, err)
+	backend := newStubBackend(0, nil)
+	l := yarl.NewWithOptions(backend, []yarl.Rule{{ID: "test", TTL: time.Minute, MaxRequests: 10}}, yarl.WithAccessList(access))
+	conf := NewConfiguration(l)
+	conf.Metadata = []string{"x-user-id"}
+	client, _ := newClient(t, conf)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-user-id", "abuser")
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "x-user-id", "alice")
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+}
+
+func TestUnaryInterceptor_CheckHook(t *testing.T) {
+	l := newLimiter(1, time.Minute, nil)
+	var keys []string
+	conf := NewConfiguration(l)
+	conf.UseMethod = true
+	conf.Check = func(ctx context.Context, key string) ([]yarl.RuleResult, error) {
+		keys = append(keys, key)
+		return l.Check(ctx, key)
+	}
+	client, _ := newClient(t, conf)
+
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{":/grpc.health.v1.Health/Check", ":/grpc.health.v1.Health/Check"}, keys)
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	client, hs := newClient(t, NewConfiguration(newLimiter(1, 30*time.Second, nil)))
+	ctx := context.Background()
+
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	require.Len(t, hs.lastResults(), 1)
+
+	stream, err = client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"0"}, stream.Trailer().Get(TrailerRemaining))
+}
+
+func TestMetadataKey_SeparateBuckets(t *testing.T) {
+	conf := NewConfiguration(newLimiter(1, time.Minute, nil))
+	conf.Metadata = []string{"x-user-id"}
+	client, _ := newClient(t, conf)
+
+	alice := metadata.AppendToOutgoingContext(context.Background(), "x-user-id", "alice")
+	bob := metadata.AppendToOutgoingContext(context.Background(), "x-user-id", "bob")
+
+	_, err := client.Check(alice, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = client.Check(alice, &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	_, err = client.Check(bob, &healthpb.HealthCheckRequest{})
+	assert.NoError(t, err)
+}
+
+func TestMethodKey_SeparateBuckets(t *testing.T) {
+	conf := NewConfiguration(newLimiter(1, time.Minute, nil))
+	conf.UseMethod = true
+	client, _ := newClient(t, conf)
+	ctx := context.Background()
+
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	// Watch has its own bucket: its first call is allowed.
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+}
+
+func TestBuildKey(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.5"), Port: 4242}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-tenant-id", "ACME"))
+
+	tests := []struct {
+		name string
+		conf Configuration
+		want string
+	}{
+		{"peer", Configuration{UsePeer: true}, "203.0.113.5"},
+		{"metadata", Configuration{Metadata: []string{"x-tenant-id"}}, ":acme"},
+		{"missing metadata", Configuration{Metadata: []string{"x-user-id"}}, ":"},
+		{"method", Configuration{UseMethod: true}, ":/pkg.Svc/Do"},
+		{"all", Configuration{UsePeer: true, Metadata: []string{"x-tenant-id"}, UseMethod: true}, "203.0.113.5:acme:/pkg.Svc/Do"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, buildKey(ctx, "/pkg.Svc/Do", &tt.conf))
+		})
+	}
+}
+
+func TestGetPeerIP(t *testing.T) {
+	assert.Equal(t, "", getPeerIP(context.Background()))
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("::1"), Port: 80}})
+	assert.Equal(t, "::1", getPeerIP(ctx))
+
+	ctx = peer.NewContext(context.Background(), &peer.Peer{Addr: bufconnAddr{}})
+	assert.Equal(t, "bufconn", getPeerIP(ctx))
+}
+
+type bufconnAddr struct{}
+
+func (bufconnAddr) Network() string { return "bufconn" }
+func (bufconnAddr) String() string  { return "bufconn" }
@@ -0,0 +1,107 @@
+package httpratelimit
+
+import (
+	"context"
+	"net/http"
+
+	yarl "github.com/logocomune/yarl/v4"
+)
+
+// FailedAuth reports whether status is 401 Unauthorized or 403 Forbidden.
+// Use it as [Configuration.CountStatus] to protect login and OTP endpoints
+// against brute force while leaving successful users unaffected.
+func FailedAuth(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// serveCountingFailures implements failure-counting mode. Quota is consumed
+// with Check before next runs, so parallel attempts cannot all pass on the same
+// count, and given back with Refund afterwards unless the response status is
+// counted. Rejected attempts are given back too: they never reach next.
+func (conf *Configuration) serveCountingFailures(w http.ResponseWriter, r *http.Request, next http.Handler, key string) {
+	// Without refunds every attempt would count; fail before consuming anything.
+	if err := conf.limiter.Refund(r.Context(), key, nil); err != nil {
+		conf.fail(w, r, key, err)
+		return
+	}
+	results, err := conf.check(r, key)
+	if err != nil {
+		conf.fail(w, r, key, err)
+		return
+	}
+	r = r.WithContext(yarl.NewContext(r.Context(), results))
+
+	// The response is already on its way; a canceled request must not skip accounting.
+	ctx := context.WithoutCancel(r.Context())
+
+	if allowed, _ := yarl.Summarize(results); !allowed {
+		conf.limit(w, r, key, results)
+		conf.refund(ctx, r, key, results)
+		return
+	}
+	conf.logger().LogDenied(r.Context(), key, results, requestAttrs(r)...) // dry-run rules only
+
+	rec := &statusRecorder{ResponseWriter: w}
+	conf.serve(rec, r, next, key, results)
+
+	status := rec.Status()
+	switch {
+	case conf.CountStatus(status):
+	case conf.ResetOnSuccess && status >= 200 && status < 300:
+		if err := conf.limiter.Reset(ctx, key); err != nil {
+			conf.logger().LogError(ctx, key, err, requestAttrs(r)...)
+		}
+	default:
+		conf.refund(ctx, r, key, results)
+	}
+}
+
+// refund gives back the quota consumed by the attempt r, logging failures.
+func (conf *Configuration) refund(ctx context.Context, r *http.Request, key string, results []yarl.RuleResult) {
+	if err := conf.limiter.Refund(ctx, key, results); err != nil {
+		conf.logger().LogError(ctx, key, err, requestAttrs(r)...)
+	}
+}
+
+// statusRecorder captures the status code written by a handler.
+// It implements Unwrap so [http.ResponseController] reaches the underlying writer.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	// 1xx informational responses are not final; keep waiting for the real status.
+	if s.status == 0 && code >= 200 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush supports handlers that type-assert http.Flusher instead of using
+// [http.ResponseController].
+func (s *statusRecorder) Flush() {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	_ = http.NewResponseController(s.ResponseWriter).Flush()
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Status returns the response status, or 200 if the handler wrote nothing.
+func (s *statusRecorder) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
@@ -1,19 +1,26 @@
 // Package httpratelimit provides rate-limiting middleware for the standard net/http package.
 //
-// Wrap any [http.HandlerFunc] with [New] to enforce rate limits based on the client
-// IP, arbitrary request headers, or a combination of both.
+// Wrap any [http.HandlerFunc] with [New], or any [http.Handler] with [Middleware],
+// to enforce rate limits based on the client IP, arbitrary request headers, or a
+// combination of both.
 // When a request violates any rule the middleware responds with HTTP 429 and a JSON
-// body listing each violated rule with its retry window.
+// body listing each violated rule with its retry window. Set
+// [Configuration.OnLimited] and [Configuration.OnError] to customise the responses,
+// e.g. with the RFC 9457 or content-negotiated handlers of package [response].
 package httpratelimit
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
 	"strings"
-	"time"
+	"sync"
 
 	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/integration/middleware/response"
 )
 
 // Configuration holds middleware settings.
@@ -24,54 +31,244 @@ type Configuration struct {
 	UseIP bool
 	// Headers lists request header names appended to the key (e.g. "X-User-ID").
 	Headers []string
+	// Check, when set, replaces the call to [yarl.Limiter.Check] on the limiter
+	// passed to NewConfiguration, which it must still check, e.g. to wrap every
+	// decision in a span with yarlotel's Telemetry.CheckFunc.
+	Check func(ctx context.Context, key string) ([]yarl.RuleResult, error)
+	// OnLimited writes the response when a request violates any rule.
+	// Defaults to [response.Violations]; see also [response.Negotiate].
+	OnLimited response.LimitedHandler
+	// OnError writes the response when the limiter fails.
+	// Defaults to [response.InternalError] (a bare HTTP 500).
+	OnError response.ErrorHandler
+	// CountStatus switches the middleware to failure-counting mode when set:
+	// quota is consumed with [yarl.Limiter.Check] before the handler runs, so
+	// parallel attempts are all counted, and given back with [yarl.Limiter.Refund]
+	// unless CountStatus reports true for the response status (e.g. [FailedAuth]).
+	// The limiter's backend must implement [yarl.RefundBackend].
+	CountStatus func(status int) bool
+	// ResetOnSuccess, in failure-counting mode, clears the key's counters with
+	// [yarl.Limiter.Reset] when the handler responds with a 2xx status.
+	// The limiter's backend must implement [yarl.ResetBackend].
+	//
+	// Do not combine it with a key made of the client IP alone: an attacker who
+	// can log in to any account, e.g. one they registered, clears their own
+	// counter between guesses. Include the targeted account in the key instead.
+	ResetOnSuccess bool
+	// Concurrency, when set, caps in-flight requests per key: a lease is acquired
+	// after the rate rules pass and released when the handler returns.
+	// Requests that find no free slot are rejected through OnLimited.
+	Concurrency *yarl.ConcurrencyLimiter
+	// Access, when set, is matched against the key, the client IP (see ClientIP)
+	// and the request headers before anything else: allowlisted requests skip all
+	// limits and denylisted ones are rejected through OnDenied. Entries can be
+	// changed at runtime with [yarl.AccessList.Update]. Header entries match
+	// values the client chooses, such as a User-Agent, unless a trusted proxy
+	// sets them.
+	Access *yarl.AccessList
+	// ClientIP returns the address the CIDR entries of Access, and of the
+	// limiter's [yarl.WithAccessList], are matched against.
+	// Defaults to [RemoteIP], the connection's peer, which a client cannot forge.
+	// Behind reverse proxies use [ForwardedFor] with the proxies' ranges. Never
+	// trust X-Forwarded-For from any client: it would let a client claim an
+	// allowlisted address and skip every limit.
+	ClientIP func(r *http.Request) netip.Addr
+	// OnDenied writes the response for denylisted requests, including those the
+	// limiter rejects with [yarl.ErrDenied]. Defaults to [response.Forbidden].
+	OnDenied response.ErrorHandler
+	// Logger, when set, logs limiter failures at Error level, and at Info level the
+	// rejected requests and those only a [yarl.Rule.DryRun] rule would reject, with
+	// the request method and path. Do not also pass it to the
+	// limiter with [yarl.WithLogger], or every event is logged twice.
+	Logger *slog.Logger
+	// LogOptions configures denial sampling and key hashing for Logger.
+	LogOptions yarl.LogOptions
+
+	logOnce sync.Once
+	log     *yarl.DecisionLogger
 }
 
 // NewConfiguration creates a Configuration backed by limiter.
+// limiter may be nil when only [Configuration.Concurrency] is used.
 func NewConfiguration(limiter *yarl.Limiter) *Configuration {
 	return &Configuration{limiter: limiter}
 }
 
 // New wraps h with rate-limiting logic defined by conf.
 // Requests that violate any rule are rejected with HTTP 429 before h is called.
+// Allowed requests reach h with the per-rule results in their context; read them
+// with [Results].
 func New(conf *Configuration, h http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		key := buildKey(r, conf)
+	return Middleware(conf)(h).ServeHTTP
+}
 
-		results, err := conf.limiter.Check(r.Context(), key)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+// Middleware returns the rate-limiting logic defined by conf as a
+// func(http.Handler) http.Handler, the shape used by chi, alice and most
+// middleware chains. It behaves exactly like [New].
+//
+// The request keeps its [http.ServeMux] path values, so
+// [http.Request.PathValue] works as it does without the middleware. The
+// http.ResponseWriter reaches next unwrapped, except in failure-counting mode
+// ([Configuration.CountStatus]): there next gets a wrapper that records the
+// status and implements only [http.Flusher]. Use [http.ResponseController],
+// which unwraps it, to hijack the connection or set deadlines.
+func Middleware(conf *Configuration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := buildKey(r, conf)
+			switch conf.access(r, key) {
+			case yarl.AccessDeny:
+				conf.deny(w, r, key)
+				return
+			case yarl.AccessAllow:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if conf.limiter == nil {
+				conf.serve(w, r, next, key, nil)
+				return
+			}
+			if conf.CountStatus != nil {
+				conf.serveCountingFailures(w, r, next, key)
+				return
+			}
+
+			results, err := conf.check(r, key)
+			if err != nil {
+				conf.fail(w, r, key, err)
+				return
+			}
+			r = r.WithContext(yarl.NewContext(r.Context(), results))
+
+			if allowed, _ := yarl.Summarize(results); !allowed {
+				conf.limit(w, r, key, results)
+				return
+			}
+			conf.logger().LogDenied(r.Context(), key, results, requestAttrs(r)...) // dry-run rules only
+
+			conf.serve(w, r, next, key, results)
+		})
+	}
+}
+
+// serve runs next, holding a lease of conf.Concurrency for its whole duration
+// when set. results are the rate-rule results already computed for the request;
+// the concurrency results are appended to them in the request context.
+func (conf *Configuration) serve(w http.ResponseWriter, r *http.Request, next http.Handler, key string, results []yarl.RuleResult) {
+	if conf.Concurrency == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	lease, leaseResults, err := conf.Concurrency.Acquire(r.Context(), key)
+	if err != nil {
+		conf.fail(w, r, key, err)
+		return
+	}
+	results = append(results[:len(results):len(results)], leaseResults...)
+	r = r.WithContext(yarl.NewContext(r.Context(), results))
 
-		if violations := collectViolations(results); len(violations) > 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusTooManyRequests)
-			_ = json.NewEncoder(w).Encode(map[string]any{"violations": violations})
-			return
+	if lease == nil {
+		conf.limit(w, r, key, results)
+		return
+	}
+	// Release even if the client went away or next panics. A lease that fails to
+	// release holds its slot until LeaseTTL, so the failure is logged.
+	defer func() {
+		ctx := context.WithoutCancel(r.Context())
+		if err := lease.Release(ctx); err != nil {
+			conf.logger().LogError(ctx, key, err, requestAttrs(r)...)
 		}
+	}()
+
+	next.ServeHTTP(w, r)
+}
+
+// check runs Check, or the limiter's Check when it is not set, with the client
+// IP in the context for the limiter's access list.
+func (conf *Configuration) check(r *http.Request, key string) ([]yarl.RuleResult, error) {
+	ctx := yarl.NewClientIPContext(r.Context(), conf.clientIP(r))
+	if conf.Check != nil {
+		return conf.Check(ctx, key)
+	}
+	return conf.limiter.Check(ctx, key)
+}
+
+// limit rejects r through OnLimited, logging the denial.
+func (conf *Configuration) limit(w http.ResponseWriter, r *http.Request, key string, results []yarl.RuleResult) {
+	conf.logger().LogDenied(r.Context(), key, results, requestAttrs(r)...)
+	conf.onLimited()(w, r, results)
+}
 
-		h.ServeHTTP(w, r)
+// fail answers r through OnError, logging err. Denylisted keys reported by the
+// limiter are answered through OnDenied instead.
+func (conf *Configuration) fail(w http.ResponseWriter, r *http.Request, key string, err error) {
+	if errors.Is(err, yarl.ErrDenied) {
+		conf.deny(w, r, key)
+		return
 	}
+	conf.logger().LogError(r.Context(), key, err, requestAttrs(r)...)
+	conf.onError()(w, r, err)
 }
 
-type violationDTO struct {
-	ID                string    `json:"id"`
-	RetryAfterSeconds int64     `json:"retry_after_seconds"`
-	ResetsAt          time.Time `json:"resets_at"`
+// deny rejects a denylisted request through OnDenied.
+func (conf *Configuration) deny(w http.ResponseWriter, r *http.Request, key string) {
+	conf.logger().LogDenylisted(r.Context(), key, requestAttrs(r)...)
+	if conf.OnDenied != nil {
+		conf.OnDenied(w, r, yarl.ErrDenied)
+		return
+	}
+	response.Forbidden(w, r, yarl.ErrDenied)
 }
 
-func collectViolations(results []yarl.RuleResult) []violationDTO {
-	var out []violationDTO
-	for _, res := range results {
-		if !res.Allowed {
-			out = append(out, violationDTO{
-				ID:                res.ID,
-				RetryAfterSeconds: int64(res.RetryAfter / time.Second),
-				ResetsAt:          res.ExpiresAt,
-			})
+// logger returns the DecisionLogger built from Logger on first use, or nil.
+func (conf *Configuration) logger() *yarl.DecisionLogger {
+	conf.logOnce.Do(func() {
+		if conf.Logger != nil {
+			conf.log = yarl.NewDecisionLogger(conf.Logger, conf.LogOptions)
 		}
+	})
+	return conf.log
+}
+
+func requestAttrs(r *http.Request) []slog.Attr {
+	return []slog.Attr{slog.String("method", r.Method), slog.String("path", r.URL.Path)}
+}
+
+func (conf *Configuration) onLimited() response.LimitedHandler {
+	if conf.OnLimited != nil {
+		return conf.OnLimited
+	}
+	return response.Violations
+}
+
+func (conf *Configuration) onError() response.ErrorHandler {
+	if conf.OnError != nil {
+		return conf.OnError
+	}
+	return response.InternalError
+}
+
+// Results returns the per-rule results computed by the middleware for r.
+// ok is false when r did not pass through the middleware.
+func Results(r *http.Request) (results []yarl.RuleResult, ok bool) {
+	return yarl.FromContext(r.Context())
+}
+
+// access matches r against conf.Access.
+func (conf *Configuration) access(r *http.Request, key string) yarl.Access {
+	if conf.Access == nil {
+		return yarl.AccessDefault
+	}
+	return conf.Access.Match(yarl.AccessSubject{Key: key, IP: conf.clientIP(r), Header: r.Header.Get})
+}
+
+// clientIP returns the address of r from ClientIP, or from [RemoteIP] when unset.
+func (conf *Configuration) clientIP(r *http.Request) netip.Addr {
+	if conf.ClientIP != nil {
+		return conf.ClientIP(r)
 	}
-	return out
+	return RemoteIP(r)
 }
 
 func buildKey(r *http.Request, conf *Configuration) string {
@@ -86,6 +283,54 @@ func buildKey(r *http.Request, conf *Configuration) string {
 	return sb.String()
 }
 
+// RemoteIP returns the address of r's peer, from r.RemoteAddr, or the zero
+// Addr if it cannot be parsed. It is the default [Configuration.ClientIP].
+func RemoteIP(r *http.Request) netip.Addr {
+	if ap, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		return ap.Addr().Unmap()
+	}
+	addr, _ := netip.ParseAddr(r.RemoteAddr)
+	return addr.Unmap()
+}
+
+// ForwardedFor returns a [Configuration.ClientIP] for servers behind reverse
+// proxies whose addresses are in trusted. When the peer is a trusted proxy, it
+// walks X-Forwarded-For from the right, skipping trusted addresses, and returns
+// the first other one: the client as seen by the outermost trusted proxy.
+// Entries to its left were written by the client and are ignored. When the
+// peer is not trusted the header is ignored and the peer address is returned.
+func ForwardedFor(trusted ...netip.Prefix) func(r *http.Request) netip.Addr {
+	isTrusted := func(addr netip.Addr) bool {
+		for _, p := range trusted {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(r *http.Request) netip.Addr {
+		addr := RemoteIP(r)
+		if !isTrusted(addr) {
+			return addr
+		}
+		var hops []string
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(v, ",")...)
+		}
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				return netip.Addr{} // matches no CIDR
+			}
+			addr = hop.Unmap()
+			if !isTrusted(addr) {
+				return addr
+			}
+		}
+		return addr
+	}
+}
+
 // getIP extracts the client IP from the request, preferring X-Forwarded-For.
 func getIP(r *http.Request) string {
 	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
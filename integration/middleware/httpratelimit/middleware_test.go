@@ -1,16 +1,22 @@
 package httpratelimit
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	yarl "github.com/logocomune/yarl/v4"
+	"github.com/logocomune/yarl/v4/integration/middleware/response"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -42,6 +48,40 @@ func (s *stubBackend) IncAndGetTTL(_ context.Context, key string, ttl time.Durat
 	return count, rem, nil
 }
 
+func (s *stubBackend) Get(_ context.Context, key string) (int64, time.Duration, error) {
+	if s.err != nil {
+		return 0, 0, s.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts[key] == 0 {
+		return 0, 0, nil
+	}
+	return s.counts[key], s.remaining, nil
+}
+
+func (s *stubBackend) Reset(_ context.Context, key string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counts, key)
+	return nil
+}
+
+func (s *stubBackend) Decrement(_ context.Context, key string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts[key] > 0 {
+		s.counts[key]--
+	}
+	return nil
+}
+
 func newLimiter(max int64, remaining time.Duration, err error) *yarl.Limiter {
 	return yarl.New(
 		newStubBackend(remaining, err),
@@ -109,6 +149,245 @@ func TestMiddleware_BackendError_Returns500(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
+func TestMiddleware_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	conf := NewConfiguration(newLimiter(1, 30*time.Second, nil))
+	conf.UseIP = true
+	conf.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+	conf.LogOptions = yarl.LogOptions{HashKeys: true}
+
+	h := New(conf, func(w http.ResponseWriter, r *http.Request) {})
+	doRequest(h, map[string]string{"X-Forwarded-For": "1.2.3.4"})
+	assert.Empty(t, buf.String(), "allowed requests are not logged")
+
+	doRequest(h, map[string]string{"X-Forwarded-For": "1.2.3.4"})
+	assert.Contains(t, buf.String(), "level=INFO")
+	assert.Contains(t, buf.String(), "rule=test retry_after=30s")
+	assert.Contains(t, buf.String(), "method=GET path=/")
+	assert.NotContains(t, buf.String(), "1.2.3.4")
+
+	buf.Reset()
+	conf = NewConfiguration(newLimiter(10, 0, errors.New("storage down")))
+	conf.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+	w := doRequest(New(conf, func(w http.ResponseWriter, r *http.Request) {}), nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, buf.String(), `level=ERROR msg="yarl: rate limiter failed" key="" error="storage down"`)
+}
+
+func TestMiddleware_DryRun(t *testing.T) {
+	var buf bytes.Buffer
+	limiter := yarl.New(newStubBackend(time.Minute, nil), yarl.Rule{ID: "shadow", TTL: time.Minute, MaxRequests: 1, DryRun: true})
+	conf := NewConfiguration(limiter)
+	conf.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	var results []yarl.RuleResult
+	h := New(conf, func(w http.ResponseWriter, r *http.Request) {
+		results, _ = Results(r)
+	})
+	for range 2 {
+		assert.Equal(t, http.StatusOK, doRequest(h, nil).Code)
+	}
+
+	require.Len(t, results, 1)
+	assert.True(t, results[0].WouldBlock)
+	assert.Contains(t, buf.String(), `msg="yarl: request would be throttled (dry run)"`)
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"), "only the second request is logged")
+}
+
+// doRequestFrom is doRequest with the connection's peer set to remoteAddr.
+func doRequestFrom(h http.Handler, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddleware_Access(t *testing.T) {
+	access, err := yarl.NewAccessList(yarl.AccessRules{
+		AllowCIDRs:   []string{"10.0.0.0/8"},
+		AllowHeaders: map[string][]string{"User-Agent": {"kube-probe/1.30"}},
+		DenyCIDRs:    []string{"192.0.2.0/24"},
+	})
+	require.NoError(t, err)
+
+	backend := newStubBackend(time.Minute, nil)
+	conf := NewConfiguration(yarl.New(backend, yarl.Rule{ID: "test", TTL: time.Minute, MaxRequests: 1}))
+	conf.UseIP = true
+	conf.Access = access
+	h := New(conf, func(w http.ResponseWriter, r *http.Request) {})
+
+	for range 3 {
+		assert.Equal(t, http.StatusOK, doRequestFrom(h, "10.1.2.3:4567", nil).Code)
+		assert.Equal(t, http.StatusOK, doRequestFrom(h, "203.0.113.1:4567", map[string]string{"User-Agent": "kube-probe/1.30"}).Code)
+	}
+	assert.Empty(t, backend.counts, "allowlisted requests must not reach the backend")
+
+	assert.Equal(t, http.StatusForbidden, doRequestFrom(h, "192.0.2.9:4567", nil).Code)
+
+	// Runtime update: the partner range is now denied.
+	require.NoError(t, access.Update(yarl.AccessRules{DenyCIDRs: []string{"10.0.0.0/8"}}))
+	assert.Equal(t, http.StatusForbidden, doRequestFrom(h, "10.1.2.3:4567", nil).Code)
+}
+
+func TestMiddleware_Access_IgnoresSpoofedForwardedFor(t *testing.T) {
+	access, err := yarl.NewAccessList(yarl.AccessRules{AllowCIDRs: []string{"10.0.0.0/8"}})
+	require.NoError(t, err)
+
+	conf := NewConfiguration(newLimiter(1, time.Minute, nil))
+	conf.Access = access
+	h := New(conf, func(w http.ResponseWriter, r *http.Request) {})
+
+	spoofed := map[string]string{"X-Forwarded-For": "10.1.2.3"}
+	assert.Equal(t, http.StatusOK, doRequestFrom(h, "203.0.113.1:4567", spoofed).Code)
+	assert.Equal(t, http.StatusTooManyRequests, doRequestFrom(h, "203.0.113.1:4567", spoofed).Code,
+		"a client-supplied X-Forwarded-For must not reach the allowlist")
+}
+
+func TestMiddleware_LimiterAccessList_IgnoresSpoofedForwardedFor(t *testing.T) {
+	access, err := yarl.NewAccessList(yarl.AccessRules{
+		AllowCIDRs: []string{"10.0.0.0/8"},
+		DenyCIDRs:  []string{"198.51.100.0/24"},
+	})
+	require.NoError(t, err)
+
+	backend := newStubBackend(time.Minute, nil)
+	l := yarl.NewWithOptions(backend, []yarl.Rule{{ID: "test", TTL: time.Minute, MaxRequests: 1}}, yarl.WithAccessList(access))
+	conf := NewConfiguration(l)
+	conf.UseIP = true // the key comes from X-Forwarded-For
+	h := New(conf, func(w http.ResponseWriter, r *http.Request) {})
+
+	spoofed := map[string]string{"X-Forwarded-For": "10.1.2.3"}
+	assert.Equal(t, http.StatusOK, doRequestFrom(h, "203.0.113.1:4567", spoofed).Code)
+	assert.Equal(t, http.StatusTooManyRequests, doRequestFrom(h, "203.0.113.1:4567", spoofed).Code,
+		"a key taken from X-Forwarded-For must not match the allowlist")
+	assert.Equal(t, http.StatusForbidden, doRequestFrom(h, "198.51.100.7:4567", map[string]string{"X-Forwarded-For": "203.0.113.9"}).Code,
+		"X-Forwarded-For must not dodge a deny CIDR")
+
+	for range 3 {
+		assert.Equal(t, http.StatusOK, doRequestFrom(h, "10.1.2.3:4567", nil).Code)
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	clientIP := ForwardedFor(netip.MustParsePrefix("10.0.0.0/8"))
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"untrusted peer ignores the header", "203.0.113.1:4567", []string{"10.1.2.3"}, "203.0.113.1"},
+		{"trusted peer", "10.0.0.1:4567", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"client-written entries are skipped", "10.0.0.1:4567", []string{"10.9.9.9, 198.51.100.7"}, "198.51.100.7"},
+		{"chain of trusted proxies", "10.0.0.1:4567", []string{"198.51.100.7, 10.0.0.2", "10.0.0.3"}, "198.51.100.7"},
+		{"only trusted hops", "10.0.0.1:4567", []string{"10.0.0.2"}, "10.0.0.2"},
+		{"no header", "10.0.0.1:4567", nil, "10.0.0.1"},
+		{"malformed hop", "10.0.0.1:4567", []string{"unknown"}, "invalid IP"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			assert.Equal(t, tt.want, clientIP(req).String())
+		})
+	}
+}
+
+func TestMiddleware_LimiterDenylist_OnDenied(t *testing.T) {
+	access, err := yarl.NewAccessList(yarl.AccessRules{DenyKeys: []string{":abuser"}})
+	require.NoError(t, err)
+
+	limiter := yarl.NewWithOptions(newStubBackend(time.Minute, nil), []yarl.Rule{{ID: "test", TTL: time.Minute, MaxRequests: 10}}, yarl.WithAccessList(access))
+	conf := NewConfiguration(limiter)
+	conf.Headers = []string{"X-User-ID"}
+	conf.OnDenied = func(w http.ResponseWriter, r *http.Request, err error) {
+		assert.ErrorIs(t, err, yarl.ErrDenied)
+		w.WriteHeader(http.StatusUnavailableForLegalReasons)
+	}
+	h := New(conf, func(w http.ResponseWriter, r *http.Request) {})
+
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, doRequest(h, map[string]string{"X-User-ID": "abuser"}).Code)
+	assert.Equal(t, http.StatusOK, doRequest(h, map[string]string{"X-User-ID": "alice"}).Code)
+}
+
+func TestMiddleware_OnLimited(t *testing.T) {
+	conf := NewConfiguration(newLimiter(0, 30*time.Second, nil))
+	var got []yarl.RuleResult
+	conf.OnLimited = func(w http.ResponseWriter, r *http.Request, results []yarl.RuleResult) {
+		got = results
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	h := New(conf, func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler must not be called for a limited request")
+	})
+
+	w := doRequest(h, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Len(t, got, 1)
+	assert.Equal(t, "test", got[0].ID)
+}
+
+func TestMiddleware_OnLimited_Negotiate(t *testing.T) {
+	conf := NewConfiguration(newLimiter(0, 30*time.Second, nil))
+	conf.OnLimited = response.Negotiate
+
+	h := New(conf, func(w http.ResponseWriter, r *http.Request) {})
+
+	w := doRequest(h, map[string]string{"Accept": "application/problem+json"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, response.ContentTypeProblem, w.Header().Get("Content-Type"))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+}
+
+func TestMiddleware_OnError(t *testing.T) {
+	storageErr := errors.New("storage down")
+	conf := NewConfiguration(newLimiter(10, 0, storageErr))
+	var got error
+	conf.OnError = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	h := New(conf, func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler must not be called when the limiter fails")
+	})
+
+	w := doRequest(h, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.ErrorIs(t, got, storageErr)
+}
+
+func TestMiddleware_ResultsInContext(t *testing.T) {
+	conf := NewConfiguration(newLimiter(5, time.Minute, nil))
+
+	var got []yarl.RuleResult
+	var ok bool
+	h := New(conf, func(w http.ResponseWriter, r *http.Request) {
+		got, ok = Results(r)
+	})
+
+	doRequest(h, nil)
+	doRequest(h, nil)
+	require.True(t, ok)
+	require.Len(t, got, 1)
+	assert.Equal(t, "test", got[0].ID)
+	assert.Equal(t, int64(2), got[0].Current)
+	assert.Equal(t, int64(3), got[0].Remaining())
+}
+
+func TestResults_WithoutMiddleware(t *testing.T) {
+	_, ok := Results(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.False(t, ok)
+}
+
 func TestMiddleware_UseHeader(t *testing.T) {
 	// User A and User B share no bucket when keyed by header
 	backend := newStubBackend(time.Minute, nil)
@@ -144,6 +423,280 @@ func TestMiddleware_NoIPNoHeaders_SharedBucket(t *testing.T) {
 	assert.Equal(t, http.StatusTooManyRequests, w.Code)
 }
 
+func TestMiddleware_HandlerChain(t *testing.T) {
+	conf := NewConfiguration(newLimiter(1, time.Minute, nil))
+
+	var order []string
+	outer := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			order = append(order, "outer")
+			next.ServeHTTP(w, r)
+		})
+	}
+	chain := outer(Middleware(conf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	})))
+
+	w := doRequest(chain, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"outer", "handler"}, order)
+
+	w = doRequest(chain, nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, []string{"outer", "handler", "outer"}, order)
+}
+
+func TestMiddleware_ServeMuxPattern(t *testing.T) {
+	conf := NewConfiguration(newLimiter(10, time.Minute, nil))
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /items/{id}", Middleware(conf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.PathValue("id")))
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/items/42", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "42", w.Body.String())
+}
+
+func TestMiddleware_ResponseController(t *testing.T) {
+	conf := NewConfiguration(newLimiter(10, time.Minute, nil))
+
+	var flushErr error
+	h := Middleware(conf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("chunk"))
+		flushErr = http.NewResponseController(w).Flush()
+	}))
+
+	w := doRequest(h, nil)
+	require.NoError(t, flushErr)
+	assert.True(t, w.Flushed)
+}
+
+// loginHandler answers 401 unless the "X-Password" header is "secret".
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Password") != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	_, _ = w.Write([]byte("welcome"))
+}
+
+func TestMiddleware_CountStatus_OnlyFailuresConsumeQuota(t *testing.T) {
+	backend := newStubBackend(time.Minute, nil)
+	conf := NewConfiguration(yarl.New(backend, yarl.Rule{ID: "login", TTL: time.Minute, MaxRequests: 2}))
+	conf.CountStatus = FailedAuth
+	h := New(conf, loginHandler)
+
+	// Successful logins never consume quota.
+	for range 5 {
+		w := doRequest(h, map[string]string{"X-Password": "secret"})
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.Zero(t, backend.counts["login:"])
+
+	// Two failures are allowed through and counted…
+	assert.Equal(t, http.StatusUnauthorized, doRequest(h, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, doRequest(h, nil).Code)
+	assert.Equal(t, int64(2), backend.counts["login:"])
+
+	// …then every attempt is rejected before reaching the handler, even a correct one.
+	w := doRequest(h, map[string]string{"X-Password": "secret"})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, int64(2), backend.counts["login:"], "rejected attempts are not counted")
+}
+
+func TestMiddleware_CountStatus_ResetOnSuccess(t *testing.T) {
+	backend := newStubBackend(time.Minute, nil)
+	conf := NewConfiguration(yarl.New(backend, yarl.Rule{ID: "login", TTL: time.Minute, MaxRequests: 3}))
+	conf.CountStatus = FailedAuth
+	conf.ResetOnSuccess = true
+	h := New(conf, loginHandler)
+
+	doRequest(h, nil)
+	doRequest(h, nil)
+	assert.Equal(t, int64(2), backend.counts["login:"])
+
+	w := doRequest(h, map[string]string{"X-Password": "secret"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, backend.counts, "login:", "success must clear the failure counter")
+}
+
+func TestMiddleware_CountStatus_ParallelBurst(t *testing.T) {
+	backend := newStubBackend(time.Minute, nil)
+	conf := NewConfiguration(yarl.New(backend, yarl.Rule{ID: "login", TTL: time.Minute, MaxRequests: 3}))
+	conf.CountStatus = FailedAuth
+
+	var reached atomic.Int32
+	h := New(conf, func(w http.ResponseWriter, r *http.Request) {
+		reached.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Go(func() {
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/login", nil))
+		})
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(3), reached.Load(), "parallel attempts must not pass on the same count")
+	assert.Equal(t, int64(3), backend.counts["login:"], "rejected attempts are given back")
+}
+
+func TestMiddleware_CountStatus_UnsupportedBackend(t *testing.T) {
+	limiter := yarl.New(&keyOnlyBackend{}, yarl.Rule{ID: "login", TTL: time.Minute, MaxRequests: 3})
+	conf := NewConfiguration(limiter)
+	conf.CountStatus = FailedAuth
+	var got error
+	conf.OnError = func(w http.ResponseWriter, r *http.Request, err error) {
+		got = err
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	w := doRequest(New(conf, loginHandler), nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.ErrorIs(t, got, yarl.ErrUnsupported)
+}
+
+// keyOnlyBackend implements only yarl.Backend.
+type keyOnlyBackend struct{}
+
+func (keyOnlyBackend) IncAndGetTTL(_ context.Context, _ string, ttl time.Duration) (int64, time.Duration, error) {
+	return 1, ttl, nil
+}
+
+func TestStatusRecorder(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    int
+	}{
+		{"nothing written", func(w http.ResponseWriter, r *http.Request) {}, http.StatusOK},
+		{"implicit 200 on Write", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("x")) }, http.StatusOK},
+		{"explicit status", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusForbidden) }, http.StatusForbidden},
+		{"first status wins", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.WriteHeader(http.StatusOK)
+		}, http.StatusUnauthorized},
+		{"1xx ignored", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusEarlyHints)
+			w.WriteHeader(http.StatusUnauthorized)
+		}, http.StatusUnauthorized},
+		{"ResponseController flush", func(w http.ResponseWriter, r *http.Request) {
+			_ = http.NewResponseController(w).Flush()
+		}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+			tt.handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, tt.want, rec.Status())
+		})
+	}
+}
+
+// stubLeaseBackend counts leases per key and ignores expiry.
+type stubLeaseBackend struct {
+	mu         sync.Mutex
+	held       map[string]int64
+	releaseErr error
+}
+
+func (s *stubLeaseBackend) Acquire(_ context.Context, key, _ string, max int64, ttl time.Duration) (bool, int64, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.held == nil {
+		s.held = make(map[string]int64)
+	}
+	if s.held[key] >= max {
+		return false, s.held[key], ttl, nil
+	}
+	s.held[key]++
+	return true, s.held[key], ttl, nil
+}
+
+func (s *stubLeaseBackend) Release(_ context.Context, key, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.releaseErr != nil {
+		return s.releaseErr
+	}
+	s.held[key]--
+	return nil
+}
+
+func TestMiddleware_Concurrency(t *testing.T) {
+	leases := &stubLeaseBackend{}
+	conf := NewConfiguration(newLimiter(100, time.Minute, nil))
+	conf.Concurrency = yarl.NewConcurrency(leases, yarl.ConcurrencyRule{ID: "exports", MaxInFlight: 1, LeaseTTL: time.Minute})
+
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	var got []yarl.RuleResult
+	h := Middleware(conf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = Results(r)
+		if r.URL.Query().Has("slow") {
+			close(entered)
+			<-unblock
+		}
+	}))
+
+	done := make(chan int)
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, "/?slow", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		done <- w.Code
+	}()
+	<-entered
+
+	w := doRequest(h, nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "second in-flight request must be rejected")
+
+	close(unblock)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, int64(0), leases.held["exports:"], "lease must be released when the handler returns")
+
+	w = doRequest(h, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, got, 2, "rate and concurrency results are both exposed")
+	assert.Equal(t, "test", got[0].ID)
+	assert.Equal(t, "exports", got[1].ID)
+}
+
+func TestMiddleware_ConcurrencyOnly_ReleasesOnPanic(t *testing.T) {
+	leases := &stubLeaseBackend{}
+	conf := NewConfiguration(nil)
+	conf.Concurrency = yarl.NewConcurrency(leases, yarl.ConcurrencyRule{ID: "c", MaxInFlight: 1, LeaseTTL: time.Minute})
+
+	h := New(conf, func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	assert.Panics(t, func() { doRequest(h, nil) })
+	assert.Equal(t, int64(0), leases.held["c:"], "lease must be released when the handler panics")
+}
+
+func TestMiddleware_Concurrency_LogsReleaseError(t *testing.T) {
+	var buf bytes.Buffer
+	leases := &stubLeaseBackend{releaseErr: errors.New("storage down")}
+	conf := NewConfiguration(nil)
+	conf.Concurrency = yarl.NewConcurrency(leases, yarl.ConcurrencyRule{ID: "c", MaxInFlight: 1, LeaseTTL: time.Minute})
+	conf.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	w := doRequest(New(conf, func(w http.ResponseWriter, r *http.Request) {}), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, buf.String(), "level=ERROR")
+	assert.Contains(t, buf.String(), `error="storage down"`)
+	assert.Contains(t, buf.String(), "method=GET path=/")
+}
+
 func TestGetIP(t *testing.T) {
 	tests := []struct {
 		name       string
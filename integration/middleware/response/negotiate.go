@@ -0,0 +1,82 @@
+package response
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// offers lists the media types the built-in handlers can produce, in order of
+// preference when the client assigns them the same quality.
+var offers = []string{ContentTypeJSON, ContentTypeProblem, ContentTypeText, ContentTypeHTML}
+
+// negotiate returns the offer (one of the ContentType constants) that best
+// matches the Accept header of r. It returns [ContentTypeJSON] when r has no
+// Accept header or nothing acceptable is offered.
+func negotiate(r *http.Request) string {
+	if r == nil {
+		return ContentTypeJSON
+	}
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return ContentTypeJSON
+	}
+
+	best, bestQ, bestSpecificity := ContentTypeJSON, 0.0, -1
+	for _, offer := range offers {
+		q, specificity := quality(accept, mediaType(offer))
+		if q > bestQ || (q == bestQ && q > 0 && specificity > bestSpecificity) {
+			best, bestQ, bestSpecificity = offer, q, specificity
+		}
+	}
+	return best
+}
+
+// quality returns the q-value the Accept header assigns to mediaType and the
+// specificity of the matching range (2 exact, 1 "type/*", 0 "*/*").
+// The most specific matching range wins, as in RFC 9110 section 12.5.1.
+func quality(accept, mediaType string) (q float64, specificity int) {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	specificity = -1
+	for part := range strings.SplitSeq(accept, ",") {
+		rng, params, _ := strings.Cut(part, ";")
+		rng = strings.ToLower(strings.TrimSpace(rng))
+
+		s := -1
+		switch {
+		case rng == mediaType:
+			s = 2
+		case rng == typ+"/*":
+			s = 1
+		case rng == "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, q = s, parseQ(params)
+	}
+	return q, specificity
+}
+
+// parseQ extracts the q parameter from a media-range parameter list, defaulting to 1.
+func parseQ(params string) float64 {
+	for p := range strings.SplitSeq(params, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok || strings.ToLower(strings.TrimSpace(name)) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || q < 0 {
+			return 0
+		}
+		return min(q, 1)
+	}
+	return 1
+}
+
+// mediaType strips parameters such as charset from a Content-Type value.
+func mediaType(contentType string) string {
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.TrimSpace(mt)
+}
@@ -0,0 +1,240 @@
+// Package response provides the rejection and error responses shared by the
+// YARL HTTP middlewares.
+//
+// A [LimitedHandler] writes the response for a request that violated at least one
+// rule; an [ErrorHandler] writes the response when [yarl.Limiter.Check] fails.
+// Built-in handlers cover the legacy JSON body ([Violations]), RFC 9457
+// problem details ([Problem]), plain text ([Text]) and HTML ([HTML]).
+// [Negotiate] and [NegotiateError] pick one of them from the request's Accept header.
+package response
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+)
+
+// LimitedHandler writes the response for a request rejected by the limiter.
+// results holds every rule evaluated for the request; at least one is not allowed.
+type LimitedHandler func(w http.ResponseWriter, r *http.Request, results []yarl.RuleResult)
+
+// ErrorHandler writes the response when the limiter returns an error.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+// Media types produced by the built-in handlers.
+const (
+	ContentTypeJSON    = "application/json"
+	ContentTypeProblem = "application/problem+json"
+	ContentTypeText    = "text/plain; charset=utf-8"
+	ContentTypeHTML    = "text/html; charset=utf-8"
+)
+
+// Violation describes one violated rule in a rejection body.
+type Violation struct {
+	ID                string    `json:"id"`
+	RetryAfterSeconds int64     `json:"retry_after_seconds"`
+	ResetsAt          time.Time `json:"resets_at"`
+}
+
+// CollectViolations returns one [Violation] per rule in results that was not allowed.
+func CollectViolations(results []yarl.RuleResult) []Violation {
+	var out []Violation
+	for _, res := range results {
+		if !res.Allowed {
+			out = append(out, Violation{
+				ID:                res.ID,
+				RetryAfterSeconds: int64(res.RetryAfter / time.Second),
+				ResetsAt:          res.ExpiresAt,
+			})
+		}
+	}
+	return out
+}
+
+// problemDetails is an RFC 9457 problem details object.
+// Violations is an extension member listing the violated rules.
+type problemDetails struct {
+	Type       string      `json:"type"`
+	Title      string      `json:"title"`
+	Status     int         `json:"status"`
+	Detail     string      `json:"detail,omitempty"`
+	Instance   string      `json:"instance,omitempty"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Violations writes HTTP 429 with the JSON body {"violations": [...]}.
+// It is the default [LimitedHandler] of the middlewares.
+func Violations(w http.ResponseWriter, _ *http.Request, results []yarl.RuleResult) {
+	setRetryAfter(w, results)
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.WriteHeader(http.StatusTooManyRequests)
+	_ = json.NewEncoder(w).Encode(map[string]any{"violations": CollectViolations(results)})
+}
+
+// Problem writes HTTP 429 with an RFC 9457 application/problem+json body.
+// The violated rules are listed in the "violations" extension member.
+func Problem(w http.ResponseWriter, r *http.Request, results []yarl.RuleResult) {
+	setRetryAfter(w, results)
+	writeProblem(w, r, problemDetails{
+		Type:       "about:blank",
+		Title:      http.StatusText(http.StatusTooManyRequests),
+		Status:     http.StatusTooManyRequests,
+		Detail:     detail(results),
+		Violations: CollectViolations(results),
+	})
+}
+
+// Text writes HTTP 429 with a plain-text body, one line per violated rule.
+func Text(w http.ResponseWriter, _ *http.Request, results []yarl.RuleResult) {
+	setRetryAfter(w, results)
+	w.Header().Set("Content-Type", ContentTypeText)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	var sb strings.Builder
+	sb.WriteString(http.StatusText(http.StatusTooManyRequests))
+	sb.WriteByte('\n')
+	for _, v := range CollectViolations(results) {
+		fmt.Fprintf(&sb, "%s: retry after %ds (resets at %s)\n", v.ID, v.RetryAfterSeconds, v.ResetsAt.UTC().Format(time.RFC3339))
+	}
+	_, _ = w.Write([]byte(sb.String()))
+}
+
+var htmlTemplate = template.Must(template.New("limited").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Detail}}</p>
+{{- if .Violations}}
+<ul>
+{{- range .Violations}}
+<li>{{.ID}}: retry after {{.RetryAfterSeconds}}s (resets at {{.ResetsAt.UTC.Format "2006-01-02T15:04:05Z07:00"}})</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
+
+// HTML writes HTTP 429 with a minimal HTML page listing the violated rules.
+func HTML(w http.ResponseWriter, _ *http.Request, results []yarl.RuleResult) {
+	setRetryAfter(w, results)
+	writeHTML(w, problemDetails{
+		Title:      http.StatusText(http.StatusTooManyRequests),
+		Status:     http.StatusTooManyRequests,
+		Detail:     detail(results),
+		Violations: CollectViolations(results),
+	})
+}
+
+// Negotiate selects [Problem], [Text], [HTML] or [Violations] from the request's
+// Accept header. [Violations] is used when the header is missing or accepts any type.
+func Negotiate(w http.ResponseWriter, r *http.Request, results []yarl.RuleResult) {
+	switch negotiate(r) {
+	case ContentTypeProblem:
+		Problem(w, r, results)
+	case ContentTypeText:
+		Text(w, r, results)
+	case ContentTypeHTML:
+		HTML(w, r, results)
+	default:
+		Violations(w, r, results)
+	}
+}
+
+// InternalError writes a bare HTTP 500 with no body.
+// It is the default [ErrorHandler] of the middlewares; err is never exposed to the client.
+func InternalError(w http.ResponseWriter, _ *http.Request, _ error) {
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+// Forbidden writes a bare HTTP 403 with no body.
+// It is the default handler of the middlewares for requests rejected by a
+// [yarl.AccessList]; err is [yarl.ErrDenied].
+func Forbidden(w http.ResponseWriter, _ *http.Request, _ error) {
+	w.WriteHeader(http.StatusForbidden)
+}
+
+// ProblemError writes HTTP 500 with an RFC 9457 application/problem+json body.
+// err is not included in the body.
+func ProblemError(w http.ResponseWriter, r *http.Request, _ error) {
+	writeProblem(w, r, problemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(http.StatusInternalServerError),
+		Status: http.StatusInternalServerError,
+	})
+}
+
+// TextError writes HTTP 500 with a plain-text body. err is not included in the body.
+func TextError(w http.ResponseWriter, _ *http.Request, _ error) {
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// HTMLError writes HTTP 500 with a minimal HTML page. err is not included in the body.
+func HTMLError(w http.ResponseWriter, _ *http.Request, _ error) {
+	writeHTML(w, problemDetails{
+		Title:  http.StatusText(http.StatusInternalServerError),
+		Status: http.StatusInternalServerError,
+	})
+}
+
+// NegotiateError selects [ProblemError], [TextError], [HTMLError] or [InternalError]
+// from the request's Accept header, mirroring [Negotiate].
+func NegotiateError(w http.ResponseWriter, r *http.Request, err error) {
+	switch negotiate(r) {
+	case ContentTypeProblem:
+		ProblemError(w, r, err)
+	case ContentTypeText:
+		TextError(w, r, err)
+	case ContentTypeHTML:
+		HTMLError(w, r, err)
+	default:
+		InternalError(w, r, err)
+	}
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p problemDetails) {
+	if r != nil && r.URL != nil {
+		p.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+func writeHTML(w http.ResponseWriter, p problemDetails) {
+	w.Header().Set("Content-Type", ContentTypeHTML)
+	w.WriteHeader(p.Status)
+	_ = htmlTemplate.Execute(w, p)
+}
+
+// setRetryAfter sets the Retry-After header to the longest RetryAfter among the
+// violated rules, rounded up to whole seconds.
+func setRetryAfter(w http.ResponseWriter, results []yarl.RuleResult) {
+	var longest time.Duration
+	for _, res := range results {
+		if !res.Allowed && res.RetryAfter > longest {
+			longest = res.RetryAfter
+		}
+	}
+	if longest <= 0 {
+		return
+	}
+	secs := int64((longest + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+}
+
+func detail(results []yarl.RuleResult) string {
+	allowed, worst := yarl.Summarize(results)
+	if allowed {
+		return "Rate limit exceeded."
+	}
+	return fmt.Sprintf("Rate limit exceeded for rule %q; retry after %s.", worst.ID, worst.RetryAfter.Round(time.Second))
+}
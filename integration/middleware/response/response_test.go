@@ -0,0 +1,168 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func limitedResults() []yarl.RuleResult {
+	now := time.Now()
+	return []yarl.RuleResult{
+		{ID: "burst", Allowed: false, Current: 4, Max: 3, ExpiresAt: now.Add(8 * time.Second), RetryAfter: 7500 * time.Millisecond},
+		{ID: "sustained", Allowed: true, Current: 4, Max: 10, ExpiresAt: now.Add(time.Minute)},
+	}
+}
+
+func newRequest(accept string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	return req
+}
+
+func TestViolations(t *testing.T) {
+	w := httptest.NewRecorder()
+	Violations(w, newRequest(""), limitedResults())
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, ContentTypeJSON, w.Header().Get("Content-Type"))
+	assert.Equal(t, "8", w.Header().Get("Retry-After"), "Retry-After must be rounded up")
+
+	var body struct {
+		Violations []Violation `json:"violations"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Violations, 1)
+	assert.Equal(t, "burst", body.Violations[0].ID)
+	assert.Equal(t, int64(7), body.Violations[0].RetryAfterSeconds)
+}
+
+func TestProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	Problem(w, newRequest(""), limitedResults())
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, ContentTypeProblem, w.Header().Get("Content-Type"))
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "about:blank", body["type"])
+	assert.Equal(t, "Too Many Requests", body["title"])
+	assert.Equal(t, float64(http.StatusTooManyRequests), body["status"])
+	assert.Equal(t, "/api/items", body["instance"])
+	assert.Contains(t, body["detail"], `"burst"`)
+	assert.Len(t, body["violations"], 1)
+}
+
+func TestText(t *testing.T) {
+	w := httptest.NewRecorder()
+	Text(w, newRequest(""), limitedResults())
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, ContentTypeText, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "burst: retry after 7s")
+	assert.NotContains(t, w.Body.String(), "sustained")
+}
+
+func TestHTML_EscapesRuleIDs(t *testing.T) {
+	results := []yarl.RuleResult{{ID: "<script>", Allowed: false, ExpiresAt: time.Now(), RetryAfter: time.Second}}
+
+	w := httptest.NewRecorder()
+	HTML(w, newRequest(""), results)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, ContentTypeHTML, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "&lt;script&gt;")
+	assert.NotContains(t, w.Body.String(), "<script>")
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ContentTypeJSON},
+		{"*/*", ContentTypeJSON},
+		{"application/json", ContentTypeJSON},
+		{"application/problem+json", ContentTypeProblem},
+		{"application/*", ContentTypeJSON},
+		{"text/plain", ContentTypeText},
+		{"text/*", ContentTypeText},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", ContentTypeHTML},
+		{"application/json;q=0.5, application/problem+json", ContentTypeProblem},
+		{"text/plain;q=0.2, text/html;q=0.4", ContentTypeHTML},
+		{"image/png", ContentTypeJSON},
+		{"*/*;q=0, text/plain", ContentTypeText},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Negotiate(w, newRequest(tt.accept), limitedResults())
+			assert.Equal(t, tt.want, w.Header().Get("Content-Type"))
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		})
+	}
+}
+
+func TestErrorHandlers(t *testing.T) {
+	err := errors.New("redis: connection refused")
+
+	tests := []struct {
+		name        string
+		handler     ErrorHandler
+		accept      string
+		contentType string
+	}{
+		{"InternalError", InternalError, "", ""},
+		{"ProblemError", ProblemError, "", ContentTypeProblem},
+		{"TextError", TextError, "", ContentTypeText},
+		{"HTMLError", HTMLError, "", ContentTypeHTML},
+		{"NegotiateError default", NegotiateError, "", ""},
+		{"NegotiateError problem", NegotiateError, "application/problem+json", ContentTypeProblem},
+		{"NegotiateError html", NegotiateError, "text/html", ContentTypeHTML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler(w, newRequest(tt.accept), err)
+
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			assert.NotContains(t, w.Body.String(), "redis", "backend errors must not leak to clients")
+		})
+	}
+}
+
+func TestForbidden(t *testing.T) {
+	w := httptest.NewRecorder()
+	Forbidden(w, newRequest(""), yarl.ErrDenied)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestParseQ(t *testing.T) {
+	tests := []struct {
+		params string
+		want   float64
+	}{
+		{"", 1},
+		{"q=0.5", 0.5},
+		{" q = 0.3 ", 0.3},
+		{"level=1;q=0", 0},
+		{"q=abc", 0},
+		{"q=2", 1},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseQ(tt.params), "params %q", tt.params)
+	}
+}
@@ -0,0 +1,116 @@
+package ratelimittransport
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// upstreamBackoff returns how long the upstream asked the client to hold off, or 0.
+//
+// It honours, in order:
+//   - Retry-After (delay-seconds or HTTP-date) on 429 and 503 responses;
+//   - RateLimit: ...;r=0;t=N (IETF httpapi-ratelimit-headers, structured form);
+//   - RateLimit: limit=L, remaining=0, reset=N (earlier draft, single header);
+//   - RateLimit-Remaining: 0 with RateLimit-Reset: N (earlier draft, separate headers).
+//
+// A 429 without any usable header yields no backoff; the local limiter still applies.
+func upstreamBackoff(resp *http.Response, now time.Time) time.Duration {
+	h := resp.Header
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if d, ok := parseRetryAfter(h.Get("Retry-After"), now); ok {
+			return d
+		}
+	}
+	if remaining, reset, ok := parseRateLimit(h.Get("RateLimit")); ok && remaining <= 0 {
+		return reset
+	}
+	if h.Get("RateLimit-Remaining") != "" {
+		remaining, err1 := strconv.ParseInt(strings.TrimSpace(h.Get("RateLimit-Remaining")), 10, 64)
+		reset, err2 := strconv.ParseInt(strings.TrimSpace(h.Get("RateLimit-Reset")), 10, 64)
+		if err1 == nil && err2 == nil && remaining <= 0 && reset > 0 {
+			return time.Duration(reset) * time.Second
+		}
+	}
+	return 0
+}
+
+// parseRetryAfter parses a Retry-After value: delay-seconds or an HTTP-date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// parseRateLimit extracts the remaining quota and reset delay from a RateLimit
+// header in either the structured ("name";r=0;t=30) or the earlier
+// (limit=100, remaining=0, reset=30) syntax. When the header lists several
+// policies, the one with the least remaining quota wins.
+func parseRateLimit(v string) (remaining int64, reset time.Duration, ok bool) {
+	if strings.TrimSpace(v) == "" {
+		return 0, 0, false
+	}
+
+	// Earlier draft: a single comma-separated parameter list.
+	if !strings.Contains(v, ";") {
+		var haveRemaining, haveReset bool
+		for part := range strings.SplitSeq(v, ",") {
+			name, value, found := strings.Cut(strings.TrimSpace(part), "=")
+			if !found {
+				continue
+			}
+			n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				continue
+			}
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "remaining":
+				remaining, haveRemaining = n, true
+			case "reset":
+				reset, haveReset = time.Duration(n)*time.Second, true
+			}
+		}
+		return remaining, reset, haveRemaining && haveReset
+	}
+
+	// Structured form: one list member per policy, each with r= and t= parameters.
+	for member := range strings.SplitSeq(v, ",") {
+		var r, t int64
+		var haveR, haveT bool
+		for param := range strings.SplitSeq(member, ";") {
+			name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found {
+				continue
+			}
+			n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				continue
+			}
+			switch strings.TrimSpace(name) {
+			case "r":
+				r, haveR = n, true
+			case "t":
+				t, haveT = n, true
+			}
+		}
+		if !haveR || !haveT {
+			continue
+		}
+		if !ok || r < remaining || (r == remaining && time.Duration(t)*time.Second > reset) {
+			remaining, reset, ok = r, time.Duration(t)*time.Second, true
+		}
+	}
+	return remaining, reset, ok
+}
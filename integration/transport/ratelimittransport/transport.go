@@ -0,0 +1,186 @@
+// Package ratelimittransport provides client-side rate limiting for net/http.
+//
+// [New] wraps an [http.RoundTripper] so that every outgoing request is checked
+// against a [yarl.Limiter] before it is sent, keyed by host (or by any
+// [Configuration.Key]). Requests over the limit either wait for quota or fail
+// fast with a [*LimitedError].
+//
+// The transport also honours the upstream's own limits: a 429 or 503 response
+// with Retry-After, or RateLimit headers reporting no remaining quota, backs off
+// that key until the announced reset.
+package ratelimittransport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+)
+
+// LimitedError is returned by the transport when a request is not sent because
+// of a local rule or an upstream backoff, and [Configuration.Wait] is false.
+type LimitedError struct {
+	Key        string
+	RetryAfter time.Duration
+	// Results holds the per-rule results of the local limiter; it is nil when the
+	// request was held back by an upstream backoff.
+	Results []yarl.RuleResult
+}
+
+func (e *LimitedError) Error() string {
+	return fmt.Sprintf("ratelimittransport: rate limit exceeded for %q, retry after %s", e.Key, e.RetryAfter)
+}
+
+// Configuration holds transport settings.
+// Create one with [NewConfiguration], then set Base, Key, Wait and MaxBackoff as needed.
+type Configuration struct {
+	limiter *yarl.Limiter
+	// Base is the RoundTripper that sends admitted requests.
+	// Defaults to [http.DefaultTransport].
+	Base http.RoundTripper
+	// Key derives the rate-limit key from an outgoing request. Defaults to [HostKey].
+	Key func(r *http.Request) string
+	// Wait blocks requests until quota is available, bounded by the request
+	// context, instead of failing fast with [*LimitedError].
+	Wait bool
+	// MaxBackoff caps the backoff announced by upstream headers. Zero means no cap.
+	MaxBackoff time.Duration
+}
+
+// NewConfiguration creates a Configuration backed by limiter.
+// limiter may be nil to only honour upstream rate-limit headers.
+func NewConfiguration(limiter *yarl.Limiter) *Configuration {
+	return &Configuration{limiter: limiter}
+}
+
+// HostKey keys requests by target host and port, e.g. "api.example.com".
+func HostKey(r *http.Request) string {
+	return r.URL.Host
+}
+
+// RouteKey keys requests by host, method and path, e.g. "api.example.com:GET:/v1/orders".
+func RouteKey(r *http.Request) string {
+	return r.URL.Host + ":" + r.Method + ":" + r.URL.Path
+}
+
+// Transport is a rate-limited [http.RoundTripper]. Create one with [New].
+type Transport struct {
+	conf *Configuration
+
+	mu      sync.Mutex
+	backoff map[string]time.Time // key → time until which the upstream asked us to hold off
+}
+
+// New returns a Transport enforcing conf.
+func New(conf *Configuration) *Transport {
+	return &Transport{conf: conf, backoff: make(map[string]time.Time)}
+}
+
+// RoundTrip implements [http.RoundTripper].
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	key := t.key(r)
+
+	if err := t.admit(r.Context(), key); err != nil {
+		if r.Body != nil {
+			_ = r.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.base().RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	if d := upstreamBackoff(resp, time.Now()); d > 0 {
+		t.backOff(key, d)
+	}
+	return resp, nil
+}
+
+// admit returns nil once the request for key may be sent.
+func (t *Transport) admit(ctx context.Context, key string) error {
+	if d := t.backoffRemaining(key); d > 0 {
+		if !t.conf.Wait {
+			return &LimitedError{Key: key, RetryAfter: d}
+		}
+		if err := sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	if t.conf.limiter == nil {
+		return nil
+	}
+	if t.conf.Wait {
+		return t.conf.limiter.Wait(ctx, key)
+	}
+	res, err := t.conf.limiter.Reserve(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !res.OK() {
+		return &LimitedError{Key: key, RetryAfter: res.Delay, Results: res.Results}
+	}
+	return nil
+}
+
+func (t *Transport) backOff(key string, d time.Duration) {
+	if t.conf.MaxBackoff > 0 {
+		d = min(d, t.conf.MaxBackoff)
+	}
+	until := time.Now().Add(d)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until.After(t.backoff[key]) {
+		t.backoff[key] = until
+	}
+}
+
+func (t *Transport) backoffRemaining(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	until, ok := t.backoff[key]
+	if !ok {
+		return 0
+	}
+	d := time.Until(until)
+	if d <= 0 {
+		delete(t.backoff, key)
+		return 0
+	}
+	return d
+}
+
+func (t *Transport) key(r *http.Request) string {
+	if t.conf.Key != nil {
+		return t.conf.Key(r)
+	}
+	return HostKey(r)
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.conf.Base != nil {
+		return t.conf.Base
+	}
+	return http.DefaultTransport
+}
+
+// sleep waits for d or until ctx is done, failing fast when d ends after the ctx deadline.
+func sleep(ctx context.Context, d time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return yarl.ErrWouldExceedDeadline
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
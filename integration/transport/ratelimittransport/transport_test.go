@@ -0,0 +1,270 @@
+package ratelimittransport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// windowBackend is a fixed-window backend on the real clock.
+type windowBackend struct {
+	mu      sync.Mutex
+	counts  map[string]int64
+	expires map[string]time.Time
+	err     error
+}
+
+func newWindowBackend() *windowBackend {
+	return &windowBackend{counts: make(map[string]int64), expires: make(map[string]time.Time)}
+}
+
+func (b *windowBackend) IncAndGetTTL(_ context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	if b.err != nil {
+		return 0, 0, b.err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if !b.expires[key].After(now) {
+		b.counts[key] = 0
+		b.expires[key] = now.Add(ttl)
+	}
+	b.counts[key]++
+	return b.counts[key], b.expires[key].Sub(now), nil
+}
+
+// stubTransport answers every request with the response built by respond.
+type stubTransport struct {
+	mu      sync.Mutex
+	calls   int
+	respond func(r *http.Request) *http.Response
+}
+
+func (s *stubTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	if s.respond != nil {
+		return s.respond(r), nil
+	}
+	return response(http.StatusOK, nil), nil
+}
+
+func (s *stubTransport) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func response(status int, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader(""))}
+}
+
+func newClient(conf *Configuration) *http.Client {
+	return &http.Client{Transport: New(conf)}
+}
+
+func get(t *testing.T, c *http.Client, url string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	return c.Do(req)
+}
+
+func TestTransport_FailFast(t *testing.T) {
+	base := &stubTransport{}
+	conf := NewConfiguration(yarl.New(newWindowBackend(), yarl.Rule{ID: "partner", TTL: time.Minute, MaxRequests: 2}))
+	conf.Base = base
+	c := newClient(conf)
+
+	for range 2 {
+		resp, err := get(t, c, "https://api.example.com/v1/orders")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	_, err := get(t, c, "https://api.example.com/v1/orders")
+	var limited *LimitedError
+	require.ErrorAs(t, err, &limited)
+	assert.Equal(t, "api.example.com", limited.Key)
+	assert.Greater(t, limited.RetryAfter, 59*time.Second)
+	assert.Len(t, limited.Results, 1)
+	assert.Equal(t, 2, base.callCount(), "limited request must not be sent")
+
+	resp, err := get(t, c, "https://other.example.com/")
+	require.NoError(t, err, "other hosts have their own bucket")
+	resp.Body.Close()
+}
+
+func TestTransport_Wait(t *testing.T) {
+	base := &stubTransport{}
+	conf := NewConfiguration(yarl.New(newWindowBackend(), yarl.Rule{ID: "partner", TTL: 100 * time.Millisecond, MaxRequests: 1}))
+	conf.Base = base
+	conf.Wait = true
+	c := newClient(conf)
+
+	start := time.Now()
+	for range 2 {
+		resp, err := get(t, c, "https://api.example.com/")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 80*time.Millisecond)
+	assert.Equal(t, 2, base.callCount())
+}
+
+func TestTransport_RouteKey(t *testing.T) {
+	conf := NewConfiguration(yarl.New(newWindowBackend(), yarl.Rule{ID: "partner", TTL: time.Minute, MaxRequests: 1}))
+	conf.Base = &stubTransport{}
+	conf.Key = RouteKey
+	c := newClient(conf)
+
+	resp, err := get(t, c, "https://api.example.com/a")
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = get(t, c, "https://api.example.com/b")
+	require.NoError(t, err, "different routes have their own bucket")
+	resp.Body.Close()
+	_, err = get(t, c, "https://api.example.com/a")
+	assert.Error(t, err)
+}
+
+func TestTransport_LimiterError(t *testing.T) {
+	backend := newWindowBackend()
+	backend.err = errors.New("storage down")
+	conf := NewConfiguration(yarl.New(backend, yarl.Rule{ID: "partner", TTL: time.Minute, MaxRequests: 1}))
+	base := &stubTransport{}
+	conf.Base = base
+
+	_, err := get(t, newClient(conf), "https://api.example.com/")
+	assert.ErrorContains(t, err, "storage down")
+	assert.Equal(t, 0, base.callCount())
+}
+
+func TestTransport_UpstreamRetryAfter_BacksOff(t *testing.T) {
+	base := &stubTransport{respond: func(r *http.Request) *http.Response {
+		return response(http.StatusTooManyRequests, http.Header{"Retry-After": {"30"}})
+	}}
+	conf := NewConfiguration(nil)
+	conf.Base = base
+	c := newClient(conf)
+
+	resp, err := get(t, c, "https://api.example.com/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	_, err = get(t, c, "https://api.example.com/")
+	var limited *LimitedError
+	require.ErrorAs(t, err, &limited)
+	assert.Greater(t, limited.RetryAfter, 29*time.Second)
+	assert.Nil(t, limited.Results)
+	assert.Equal(t, 1, base.callCount(), "backed-off key must not reach the upstream")
+}
+
+func TestTransport_UpstreamBackoff_MaxBackoffAndWait(t *testing.T) {
+	var mu sync.Mutex
+	first := true
+	base := &stubTransport{respond: func(r *http.Request) *http.Response {
+		mu.Lock()
+		defer mu.Unlock()
+		if first {
+			first = false
+			return response(http.StatusOK, http.Header{"Ratelimit": {`"default";r=0;t=3600`}})
+		}
+		return response(http.StatusOK, nil)
+	}}
+	conf := NewConfiguration(nil)
+	conf.Base = base
+	conf.Wait = true
+	conf.MaxBackoff = 100 * time.Millisecond
+	c := newClient(conf)
+
+	start := time.Now()
+	for range 2 {
+		resp, err := get(t, c, "https://api.example.com/")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 80*time.Millisecond, "second request must wait for the backoff")
+	assert.Less(t, elapsed, time.Second, "MaxBackoff must cap the announced reset")
+}
+
+func TestTransport_WaitRespectsContext(t *testing.T) {
+	conf := NewConfiguration(yarl.New(newWindowBackend(), yarl.Rule{ID: "partner", TTL: time.Hour, MaxRequests: 0}))
+	conf.Base = &stubTransport{}
+	conf.Wait = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.example.com/", nil)
+	require.NoError(t, err)
+
+	_, err = newClient(conf).Do(req)
+	assert.ErrorIs(t, err, yarl.ErrWouldExceedDeadline)
+}
+
+func TestTransport_ClosesBodyWhenLimited(t *testing.T) {
+	conf := NewConfiguration(yarl.New(newWindowBackend(), yarl.Rule{ID: "partner", TTL: time.Hour, MaxRequests: 0}))
+	conf.Base = &stubTransport{}
+
+	body := &closeRecorder{Reader: strings.NewReader("payload")}
+	req := httptest.NewRequest(http.MethodPost, "https://api.example.com/", body)
+	_, err := New(conf).RoundTrip(req)
+	require.Error(t, err)
+	assert.True(t, body.closed, "RoundTrip must close the request body on error")
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestUpstreamBackoff(t *testing.T) {
+	now := time.Date(2026, 4, 24, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		want   time.Duration
+	}{
+		{"no headers", http.StatusOK, nil, 0},
+		{"429 without headers", http.StatusTooManyRequests, nil, 0},
+		{"Retry-After seconds", http.StatusTooManyRequests, http.Header{"Retry-After": {"12"}}, 12 * time.Second},
+		{"Retry-After date", http.StatusServiceUnavailable, http.Header{"Retry-After": {now.Add(90 * time.Second).Format(http.TimeFormat)}}, 90 * time.Second},
+		{"Retry-After in the past", http.StatusTooManyRequests, http.Header{"Retry-After": {now.Add(-time.Minute).Format(http.TimeFormat)}}, 0},
+		{"Retry-After ignored on 200", http.StatusOK, http.Header{"Retry-After": {"12"}}, 0},
+		{"Retry-After garbage", http.StatusTooManyRequests, http.Header{"Retry-After": {"soon"}}, 0},
+		{"RateLimit structured exhausted", http.StatusOK, http.Header{"Ratelimit": {`"default";r=0;t=30`}}, 30 * time.Second},
+		{"RateLimit structured remaining", http.StatusOK, http.Header{"Ratelimit": {`"default";r=5;t=30`}}, 0},
+		{"RateLimit structured several policies", http.StatusOK, http.Header{"Ratelimit": {`"burst";r=4;t=1, "day";r=0;t=3600`}}, time.Hour},
+		{"RateLimit earlier draft", http.StatusOK, http.Header{"Ratelimit": {"limit=100, remaining=0, reset=45"}}, 45 * time.Second},
+		{"RateLimit-Remaining/Reset", http.StatusOK, http.Header{"Ratelimit-Remaining": {"0"}, "Ratelimit-Reset": {"20"}}, 20 * time.Second},
+		{"RateLimit-Remaining not exhausted", http.StatusOK, http.Header{"Ratelimit-Remaining": {"3"}, "Ratelimit-Reset": {"20"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, upstreamBackoff(response(tt.status, tt.header), now))
+		})
+	}
+}
@@ -7,9 +7,23 @@ package yarl
 
 import (
 	"context"
+	"errors"
+	"math"
 	"time"
 )
 
+// ErrUnsupported is returned by [Limiter] methods that need an optional backend
+// extension (such as [PeekBackend] or [ResetBackend]) the backend does not implement.
+var ErrUnsupported = errors.New("yarl: operation not supported by backend")
+
+// ErrBackendFull is returned by [Limiter.Check] when the backend refuses to
+// store the violation or ban state of a [BanPolicy] because it is full.
+var ErrBackendFull = errors.New("yarl: backend is full")
+
+// Saturated is the count a backend returns from IncAndGetTTL for a new key it
+// refuses to store because it is full. It violates every rule.
+const Saturated int64 = math.MaxInt64
+
 // Rule defines one rate-limit policy.
 // Each Rule gets its own key in the backend: "{ID}:{userKey}".
 // ID must be unique within the rules passed to [New].
@@ -17,6 +31,9 @@ type Rule struct {
 	ID          string        // key namespace; must be unique per Limiter
 	TTL         time.Duration // window duration and key expiry
 	MaxRequests int64         // allowed requests per window
+	// DryRun counts and reports the rule without enforcing it: a violation sets
+	// RuleResult.WouldBlock instead of clearing Allowed. See also [WithDryRun].
+	DryRun bool
 }
 
 // RuleResult is the outcome for one [Rule] after a [Limiter.Check] call.
@@ -27,6 +44,14 @@ type RuleResult struct {
 	Max        int64         // copy of Rule.MaxRequests
 	ExpiresAt  time.Time     // when the current window resets
 	RetryAfter time.Duration // > 0 only when Allowed == false
+	WouldBlock bool          // a DryRun rule was violated; Allowed stays true
+	Banned     bool          // the key is banned by the Limiter's [BanPolicy]; RetryAfter is the ban's remainder
+}
+
+// Remaining returns how many more requests the rule allows in the current window.
+// It is 0 once the limit is reached or exceeded.
+func (r RuleResult) Remaining() int64 {
+	return max(r.Max-r.Current, 0)
 }
 
 // Backend is the storage interface for [Limiter].
@@ -59,22 +84,72 @@ type BatchBackend interface {
 	IncAndGetTTLBatch(ctx context.Context, entries []BatchEntry) ([]BatchResult, error)
 }
 
+// PeekBackend is an optional extension of [Backend] for backends that can read a
+// counter without incrementing it. [Limiter.Peek] requires it.
+type PeekBackend interface {
+	Backend
+	// Get returns the current counter value for key and its remaining TTL
+	// without modifying either. A missing or expired key yields (0, 0, nil).
+	Get(ctx context.Context, key string) (count int64, remaining time.Duration, err error)
+}
+
+// ResetBackend is an optional extension of [Backend] for backends that can delete
+// a counter before its window expires. [Limiter.Reset] requires it.
+type ResetBackend interface {
+	Backend
+	// Reset deletes the counter for key. Resetting a missing key is not an error.
+	Reset(ctx context.Context, key string) error
+}
+
+// RefundBackend is an optional extension of [Backend] for backends that can give
+// back a counted request. [Limiter.Refund] requires it.
+type RefundBackend interface {
+	Backend
+	// Decrement lowers the counter for key by 1 without changing its expiry.
+	// A missing or expired key, or a counter already at 0, is left untouched.
+	Decrement(ctx context.Context, key string) error
+}
+
 // Limiter evaluates a fixed set of [Rule] values on every [Limiter.Check] call.
 type Limiter struct {
-	backend Backend
-	rules   []Rule
+	backend   Backend
+	rules     []Rule
+	observers []Observer
+	ban       *banPolicy
+	access    *AccessList
+	clock     Clock
 }
 
 // New creates a Limiter backed by b. Rules are fixed for the lifetime of the Limiter.
 // Each rule must have a unique ID.
 func New(b Backend, rules ...Rule) *Limiter {
-	return &Limiter{backend: b, rules: rules}
+	return &Limiter{backend: b, rules: rules, clock: SystemClock}
 }
 
 // Check evaluates every Rule against userKey and returns one [RuleResult] per Rule.
 // All rules are always evaluated; Check does not short-circuit on first violation.
 // If the backend implements [BatchBackend], all rules are evaluated in a single round-trip.
+// Observers registered with [WithObserver] are notified before Check returns.
 func (l *Limiter) Check(ctx context.Context, userKey string) ([]RuleResult, error) {
+	results, err := l.check(ctx, userKey)
+	l.observe(ctx, userKey, results, err)
+	return results, err
+}
+
+func (l *Limiter) check(ctx context.Context, userKey string) ([]RuleResult, error) {
+	if l.access != nil {
+		if results, err := l.accessResults(ctx, userKey); err != nil || results != nil {
+			return results, err
+		}
+	}
+	if l.ban != nil {
+		return l.ban.check(ctx, l, userKey)
+	}
+	return l.count(ctx, userKey)
+}
+
+// count increments the counter of every rule for userKey.
+func (l *Limiter) count(ctx context.Context, userKey string) ([]RuleResult, error) {
 	if bb, ok := l.backend.(BatchBackend); ok {
 		return l.checkBatch(ctx, userKey, bb)
 	}
@@ -88,7 +163,7 @@ func (l *Limiter) checkSerial(ctx context.Context, userKey string) ([]RuleResult
 		if err != nil {
 			return nil, err
 		}
-		results = append(results, toResult(rule, count, remaining))
+		results = append(results, toResult(rule, count, remaining, l.clock.Now()))
 	}
 	return results, nil
 }
@@ -104,13 +179,89 @@ func (l *Limiter) checkBatch(ctx context.Context, userKey string, bb BatchBacken
 		return nil, err
 	}
 
+	now := l.clock.Now()
 	results := make([]RuleResult, len(l.rules))
 	for i, rule := range l.rules {
-		results[i] = toResult(rule, batchResults[i].Count, batchResults[i].Remaining)
+		results[i] = toResult(rule, batchResults[i].Count, batchResults[i].Remaining, now)
+	}
+	return results, nil
+}
+
+// Peek evaluates every Rule against userKey without consuming quota.
+// A result is Allowed when one more request would still fit in the rule's current
+// window, i.e. when Current < Max. A key banned by the Limiter's [BanPolicy] is
+// reported as banned. It returns [ErrUnsupported] if the backend does not
+// implement [PeekBackend].
+func (l *Limiter) Peek(ctx context.Context, userKey string) ([]RuleResult, error) {
+	if l.access != nil {
+		if results, err := l.accessResults(ctx, userKey); err != nil || results != nil {
+			return results, err
+		}
+	}
+	pb, ok := l.backend.(PeekBackend)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	if l.ban != nil {
+		if results, err := l.ban.banned(ctx, l, pb, userKey); err != nil || results != nil {
+			return results, err
+		}
+	}
+
+	results := make([]RuleResult, 0, len(l.rules))
+	for _, rule := range l.rules {
+		count, remaining, err := pb.Get(ctx, rule.ID+":"+userKey)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, toPeekResult(rule, count, remaining, l.clock.Now()))
 	}
 	return results, nil
 }
 
+// Reset deletes the counters of every Rule for userKey, starting fresh windows.
+// With a [BanPolicy] it also lifts any ban of userKey and forgets its violations.
+// It returns [ErrUnsupported] if the backend does not implement [ResetBackend].
+func (l *Limiter) Reset(ctx context.Context, userKey string) error {
+	rb, ok := l.backend.(ResetBackend)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	for _, rule := range l.rules {
+		if err := rb.Reset(ctx, rule.ID+":"+userKey); err != nil {
+			return err
+		}
+	}
+	if l.ban != nil {
+		return l.ban.reset(ctx, rb, userKey)
+	}
+	return nil
+}
+
+// Refund gives back the quota that one [Limiter.Check] call consumed for userKey,
+// e.g. once the response shows the request should not have counted. Pass the
+// results of that Check: rules it did not count, because userKey was
+// allowlisted or banned, are skipped. It returns [ErrUnsupported] if the
+// backend does not implement [RefundBackend]; with no results that is all it
+// does, so Refund(ctx, userKey, nil) checks for support up front.
+func (l *Limiter) Refund(ctx context.Context, userKey string, results []RuleResult) error {
+	rb, ok := l.backend.(RefundBackend)
+	if !ok {
+		return ErrUnsupported
+	}
+
+	for _, res := range results {
+		if res.Current == 0 || res.Banned {
+			continue
+		}
+		if err := rb.Decrement(ctx, res.ID+":"+userKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Summarize scans results and reports whether all rules passed.
 // If any rule was violated it also returns the violated rule with the furthest
 // ExpiresAt — i.e. the one the caller must wait the longest to retry.
@@ -126,17 +277,47 @@ func Summarize(results []RuleResult) (allowed bool, worst *RuleResult) {
 	return worst == nil, worst
 }
 
-func toResult(rule Rule, count int64, remaining time.Duration) RuleResult {
+func toResult(rule Rule, count int64, remaining time.Duration, now time.Time) RuleResult {
 	allowed := count <= rule.MaxRequests
 	r := RuleResult{
 		ID:        rule.ID,
 		Allowed:   allowed,
 		Current:   count,
 		Max:       rule.MaxRequests,
-		ExpiresAt: time.Now().Add(remaining),
+		ExpiresAt: now.Add(remaining),
 	}
 	if !allowed {
 		r.RetryAfter = remaining
 	}
+	return dryRun(rule, r)
+}
+
+// dryRun turns a violation of a DryRun rule into an allowed result with WouldBlock set.
+func dryRun(rule Rule, r RuleResult) RuleResult {
+	if rule.DryRun && !r.Allowed {
+		r.Allowed, r.WouldBlock, r.RetryAfter = true, true, 0
+	}
 	return r
 }
+
+// toPeekResult builds the result of a read-only evaluation: the request being
+// considered has not been counted yet, so it fits while count < MaxRequests.
+func toPeekResult(rule Rule, count int64, remaining time.Duration, now time.Time) RuleResult {
+	allowed := count < rule.MaxRequests
+	r := RuleResult{
+		ID:        rule.ID,
+		Allowed:   allowed,
+		Current:   count,
+		Max:       rule.MaxRequests,
+		ExpiresAt: now.Add(remaining),
+	}
+	if !allowed {
+		if remaining <= 0 {
+			// MaxRequests == 0 with no live window: nothing will ever fit,
+			// report one full window as the retry delay.
+			remaining = rule.TTL
+		}
+		r.RetryAfter = remaining
+	}
+	return dryRun(rule, r)
+}
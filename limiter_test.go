@@ -255,7 +255,7 @@ func TestToResult_Invariants(t *testing.T) {
 		remaining := time.Duration(remainingSec) * time.Second
 		rule := Rule{ID: "r", TTL: time.Minute, MaxRequests: maxReq}
 
-		r := toResult(rule, count, remaining)
+		r := toResult(rule, count, remaining, time.Now())
 
 		if r.Allowed != (count <= maxReq) {
 			return false
@@ -402,3 +402,145 @@ func TestLimiter_Check_BatchResultsMatchSerialResults(t *testing.T) {
 		assert.Equal(t, batchResults[i].Max, serialResults[i].Max)
 	}
 }
+
+func TestRuleResult_Remaining(t *testing.T) {
+	assert.Equal(t, int64(7), RuleResult{Current: 3, Max: 10}.Remaining())
+	assert.Equal(t, int64(0), RuleResult{Current: 10, Max: 10}.Remaining())
+	assert.Equal(t, int64(0), RuleResult{Current: 12, Max: 10}.Remaining(), "Remaining must not go negative")
+}
+
+func TestContext_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	_, ok := FromContext(ctx)
+	assert.False(t, ok)
+
+	results := []RuleResult{{ID: "r1", Allowed: true, Current: 1, Max: 5}}
+	got, ok := FromContext(NewContext(ctx, results))
+	require.True(t, ok)
+	assert.Equal(t, results, got)
+}
+
+// peekBackend is a mockBackend that also implements PeekBackend and ResetBackend.
+type peekBackend struct {
+	*mockBackend
+}
+
+func (p peekBackend) Get(_ context.Context, key string) (int64, time.Duration, error) {
+	if p.err != nil {
+		return 0, 0, p.err
+	}
+	count := p.counts[key]
+	if count == 0 {
+		return 0, 0, nil
+	}
+	return count, p.remaining, nil
+}
+
+func (p peekBackend) Reset(_ context.Context, key string) error {
+	if p.err != nil {
+		return p.err
+	}
+	delete(p.counts, key)
+	return nil
+}
+
+func (p peekBackend) Decrement(_ context.Context, key string) error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.counts[key] > 0 {
+		p.counts[key]--
+	}
+	return nil
+}
+
+func TestLimiter_Peek(t *testing.T) {
+	ctx := context.Background()
+	b := peekBackend{newMockBackend(30*time.Second, nil)}
+	l := New(b, Rule{ID: "r1", TTL: time.Minute, MaxRequests: 2})
+
+	results, err := l.Peek(ctx, "u")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.True(t, results[0].Allowed)
+	assert.Equal(t, int64(0), results[0].Current)
+	assert.Empty(t, b.counts, "Peek must not increment")
+
+	_, _ = l.Check(ctx, "u")
+	results, err = l.Peek(ctx, "u")
+	require.NoError(t, err)
+	assert.True(t, results[0].Allowed, "one more request still fits")
+	assert.Equal(t, int64(1), results[0].Current)
+
+	_, _ = l.Check(ctx, "u")
+	results, err = l.Peek(ctx, "u")
+	require.NoError(t, err)
+	assert.False(t, results[0].Allowed, "limit reached: the next request would be denied")
+	assert.Equal(t, 30*time.Second, results[0].RetryAfter)
+}
+
+func TestLimiter_Peek_ZeroMax(t *testing.T) {
+	l := New(peekBackend{newMockBackend(0, nil)}, Rule{ID: "r1", TTL: time.Minute, MaxRequests: 0})
+
+	results, err := l.Peek(context.Background(), "u")
+	require.NoError(t, err)
+	assert.False(t, results[0].Allowed)
+	assert.Equal(t, time.Minute, results[0].RetryAfter, "RetryAfter must be > 0 when not allowed")
+}
+
+func TestLimiter_Reset(t *testing.T) {
+	ctx := context.Background()
+	b := peekBackend{newMockBackend(time.Minute, nil)}
+	l := New(b,
+		Rule{ID: "r1", TTL: time.Minute, MaxRequests: 1},
+		Rule{ID: "r2", TTL: time.Hour, MaxRequests: 1},
+	)
+
+	_, _ = l.Check(ctx, "u")
+	_, _ = l.Check(ctx, "other")
+	require.NoError(t, l.Reset(ctx, "u"))
+
+	assert.NotContains(t, b.counts, "r1:u")
+	assert.NotContains(t, b.counts, "r2:u")
+	assert.Contains(t, b.counts, "r1:other", "Reset must only touch the given key")
+}
+
+func TestLimiter_Refund(t *testing.T) {
+	ctx := context.Background()
+	b := peekBackend{newMockBackend(time.Minute, nil)}
+	l := New(b,
+		Rule{ID: "r1", TTL: time.Minute, MaxRequests: 1},
+		Rule{ID: "r2", TTL: time.Hour, MaxRequests: 1},
+	)
+
+	results, err := l.Check(ctx, "u")
+	require.NoError(t, err)
+	require.NoError(t, l.Refund(ctx, "u", results))
+	assert.Zero(t, b.counts["r1:u"])
+	assert.Zero(t, b.counts["r2:u"])
+
+	// Results of rules that were not counted are skipped.
+	require.NoError(t, l.Refund(ctx, "u", []RuleResult{{ID: "r1"}, {ID: "r2", Current: 1, Banned: true}}))
+	assert.Zero(t, b.counts["r1:u"])
+}
+
+func TestLimiter_Refund_Unsupported(t *testing.T) {
+	l := New(newMockBackend(time.Minute, nil), Rule{ID: "r1", TTL: time.Minute, MaxRequests: 1})
+	assert.ErrorIs(t, l.Refund(context.Background(), "u", nil), ErrUnsupported)
+}
+
+func TestLimiter_PeekReset_Unsupported(t *testing.T) {
+	l := New(newMockBackend(time.Minute, nil), Rule{ID: "r1", TTL: time.Minute, MaxRequests: 1})
+
+	_, err := l.Peek(context.Background(), "u")
+	assert.ErrorIs(t, err, ErrUnsupported)
+	assert.ErrorIs(t, l.Reset(context.Background(), "u"), ErrUnsupported)
+}
+
+func TestLimiter_PeekReset_BackendError(t *testing.T) {
+	l := New(peekBackend{newMockBackend(0, errors.New("down"))}, Rule{ID: "r1", TTL: time.Minute, MaxRequests: 1})
+
+	_, err := l.Peek(context.Background(), "u")
+	assert.Error(t, err)
+	assert.Error(t, l.Reset(context.Background(), "u"))
+}
@@ -0,0 +1,151 @@
+package yarl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// LogOptions controls what a [DecisionLogger] writes.
+type LogOptions struct {
+	// SampleDenials logs one denial out of every SampleDenials, starting with the
+	// first. 0 and 1 log every denial. Backend errors are never sampled.
+	SampleDenials uint64
+	// HashKeys replaces user keys with the first 16 hex digits of their SHA-256,
+	// logged as key_hash, for keys that hold personal data such as IPs.
+	HashKeys bool
+}
+
+// DecisionLogger logs denials and backend errors with [log/slog].
+// It implements [Observer]; register it with [WithLogger], or call its methods
+// from a middleware. A nil *DecisionLogger logs nothing.
+// Create one with [NewDecisionLogger].
+type DecisionLogger struct {
+	logger  *slog.Logger
+	opts    LogOptions
+	denials atomic.Uint64
+}
+
+// NewDecisionLogger creates a DecisionLogger writing to logger.
+func NewDecisionLogger(logger *slog.Logger, opts LogOptions) *DecisionLogger {
+	return &DecisionLogger{logger: logger, opts: opts}
+}
+
+// WithLogger logs the Limiter's denials and backend errors to logger.
+func WithLogger(logger *slog.Logger, opts LogOptions) Option {
+	return WithObserver(NewDecisionLogger(logger, opts))
+}
+
+// Observe implements [Observer]: it logs failed checks with [DecisionLogger.LogError]
+// denied or dry-run blocked ones with [DecisionLogger.LogDenied] and denylisted
+// ones with [DecisionLogger.LogDenylisted].
+func (dl *DecisionLogger) Observe(ctx context.Context, d Decision) {
+	if errors.Is(d.Err, ErrDenied) {
+		dl.LogDenylisted(ctx, d.Key)
+		return
+	}
+	if d.Err != nil {
+		ids := make([]string, len(d.Rules))
+		for i, r := range d.Rules {
+			ids[i] = r.ID
+		}
+		dl.LogError(ctx, d.Key, d.Err, slog.Any("rules", ids))
+		return
+	}
+	dl.LogDenied(ctx, d.Key, d.Results)
+}
+
+// LogDenied logs results at Info level when a rule was violated, or would have
+// been violated if it were not a [Rule.DryRun] rule, subject to
+// [LogOptions.SampleDenials]. The record names the violated rule with the
+// longest wait and its retry delay, followed by attrs. Results where every rule
+// passed are not logged, so callers may pass every decision.
+func (dl *DecisionLogger) LogDenied(ctx context.Context, key string, results []RuleResult, attrs ...slog.Attr) {
+	if dl == nil {
+		return
+	}
+	msg := "yarl: request throttled"
+	allowed, worst := Summarize(results)
+	if allowed {
+		if worst = wouldBlock(results); worst == nil {
+			return
+		}
+		msg = "yarl: request would be throttled (dry run)"
+	}
+	if !dl.logger.Enabled(ctx, slog.LevelInfo) {
+		return
+	}
+	if !dl.sample() {
+		return
+	}
+
+	retryAfter := worst.RetryAfter
+	if worst.WouldBlock {
+		retryAfter = max(time.Until(worst.ExpiresAt), 0)
+	}
+	record := append([]slog.Attr{
+		dl.keyAttr(key),
+		slog.String("rule", worst.ID),
+		slog.Duration("retry_after", retryAfter),
+		slog.Int64("current", worst.Current),
+		slog.Int64("max", worst.Max),
+	}, attrs...)
+	if worst.Banned {
+		record = append(record, slog.Bool("banned", true))
+	}
+	if n := dl.opts.SampleDenials; n > 1 {
+		record = append(record, slog.Uint64("sample_rate", n))
+	}
+	dl.logger.LogAttrs(ctx, slog.LevelInfo, msg, record...)
+}
+
+// wouldBlock returns the dry-run violation with the furthest ExpiresAt, or nil.
+func wouldBlock(results []RuleResult) *RuleResult {
+	var worst *RuleResult
+	for i := range results {
+		if results[i].WouldBlock && (worst == nil || results[i].ExpiresAt.After(worst.ExpiresAt)) {
+			worst = &results[i]
+		}
+	}
+	return worst
+}
+
+// LogDenylisted logs at Info level a request rejected by an [AccessList],
+// followed by attrs. It is sampled together with LogDenied.
+func (dl *DecisionLogger) LogDenylisted(ctx context.Context, key string, attrs ...slog.Attr) {
+	if dl == nil || !dl.logger.Enabled(ctx, slog.LevelInfo) || !dl.sample() {
+		return
+	}
+	record := append([]slog.Attr{dl.keyAttr(key)}, attrs...)
+	if n := dl.opts.SampleDenials; n > 1 {
+		record = append(record, slog.Uint64("sample_rate", n))
+	}
+	dl.logger.LogAttrs(ctx, slog.LevelInfo, "yarl: request denylisted", record...)
+}
+
+// sample reports whether the current denial is one of the logged ones.
+func (dl *DecisionLogger) sample() bool {
+	n := dl.opts.SampleDenials
+	return n <= 1 || (dl.denials.Add(1)-1)%n == 0
+}
+
+// LogError logs a limiter or backend failure at Error level, followed by attrs.
+func (dl *DecisionLogger) LogError(ctx context.Context, key string, err error, attrs ...slog.Attr) {
+	if dl == nil {
+		return
+	}
+	record := append([]slog.Attr{dl.keyAttr(key), slog.Any("error", err)}, attrs...)
+	dl.logger.LogAttrs(ctx, slog.LevelError, "yarl: rate limiter failed", record...)
+}
+
+func (dl *DecisionLogger) keyAttr(key string) slog.Attr {
+	if !dl.opts.HashKeys {
+		return slog.String("key", key)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return slog.String("key_hash", hex.EncodeToString(sum[:8]))
+}
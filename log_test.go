@@ -0,0 +1,97 @@
+package yarl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for line := range strings.Lines(buf.String()) {
+		var rec map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestWithLogger_Denials(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	rules := []Rule{{ID: "r1", TTL: time.Minute, MaxRequests: 1}}
+	l := NewWithOptions(newMockBackend(30*time.Second, nil), rules, WithLogger(logger, LogOptions{SampleDenials: 2}))
+
+	for range 6 { // 1 allowed, 5 denied
+		_, err := l.Check(context.Background(), "alice")
+		require.NoError(t, err)
+	}
+
+	records := logRecords(t, &buf)
+	require.Len(t, records, 3, "denials 1, 3 and 5 are logged")
+	rec := records[0]
+	assert.Equal(t, "INFO", rec["level"])
+	assert.Equal(t, "alice", rec["key"])
+	assert.Equal(t, "r1", rec["rule"])
+	assert.Equal(t, float64(30*time.Second), rec["retry_after"])
+	assert.Equal(t, float64(2), rec["current"])
+	assert.Equal(t, float64(1), rec["max"])
+	assert.Equal(t, float64(2), rec["sample_rate"])
+}
+
+func TestWithLogger_Errors(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	rules := []Rule{{ID: "r1", TTL: time.Minute, MaxRequests: 1}, {ID: "r2", TTL: time.Hour, MaxRequests: 5}}
+	l := NewWithOptions(newMockBackend(time.Minute, errors.New("connection refused")), rules,
+		WithLogger(logger, LogOptions{SampleDenials: 100, HashKeys: true}))
+
+	_, err := l.Check(context.Background(), "10.0.0.1")
+	require.Error(t, err)
+
+	records := logRecords(t, &buf)
+	require.Len(t, records, 1)
+	rec := records[0]
+	assert.Equal(t, "ERROR", rec["level"])
+	assert.Equal(t, "connection refused", rec["error"])
+	assert.Equal(t, []any{"r1", "r2"}, rec["rules"])
+	assert.NotContains(t, rec, "key")
+	assert.Len(t, rec["key_hash"], 16)
+	assert.NotContains(t, buf.String(), "10.0.0.1")
+}
+
+func TestDecisionLogger_Nil(t *testing.T) {
+	var dl *DecisionLogger
+	assert.NotPanics(t, func() {
+		dl.LogDenied(context.Background(), "k", []RuleResult{{ID: "r", Allowed: false}})
+		dl.LogError(context.Background(), "k", errors.New("boom"))
+	})
+}
+
+func TestWithLogger_DryRun(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	rules := []Rule{{ID: "shadow", TTL: time.Minute, MaxRequests: 1, DryRun: true}}
+	l := NewWithOptions(newMockBackend(time.Minute, nil), rules, WithLogger(logger, LogOptions{}))
+
+	for range 2 {
+		results, err := l.Check(context.Background(), "alice")
+		require.NoError(t, err)
+		require.True(t, results[0].Allowed)
+	}
+
+	records := logRecords(t, &buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, "yarl: request would be throttled (dry run)", records[0]["msg"])
+	assert.Equal(t, "shadow", records[0]["rule"])
+	assert.Greater(t, records[0]["retry_after"], float64(0))
+}
@@ -0,0 +1,135 @@
+package yarl
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Decision describes one [Limiter.Check] call. It is passed to every [Observer].
+type Decision struct {
+	// Key is the userKey passed to Check.
+	Key string
+	// Rules are the Limiter's rules, in evaluation order. Observers must not modify them.
+	Rules []Rule
+	// Results holds one [RuleResult] per Rule; nil when Err is set.
+	Results []RuleResult
+	// Err is the backend error Check returned, if any.
+	Err error
+}
+
+// Allowed reports whether Check succeeded and every rule passed.
+func (d Decision) Allowed() bool {
+	if d.Err != nil {
+		return false
+	}
+	allowed, _ := Summarize(d.Results)
+	return allowed
+}
+
+// Observer is notified of every [Limiter.Check] decision, including failed ones.
+// Observe runs synchronously on the caller's goroutine before Check returns, so
+// it must be fast and safe for concurrent use; wrap slow observers with
+// [NewAsyncObserver].
+type Observer interface {
+	Observe(ctx context.Context, d Decision)
+}
+
+// ObserverFunc adapts a function to the [Observer] interface.
+type ObserverFunc func(ctx context.Context, d Decision)
+
+// Observe calls f(ctx, d).
+func (f ObserverFunc) Observe(ctx context.Context, d Decision) {
+	f(ctx, d)
+}
+
+// WithObserver adds o to the observers notified of every decision.
+// Observers are called in the order they were added.
+func WithObserver(o Observer) Option {
+	return func(l *Limiter) {
+		l.observers = append(l.observers, o)
+	}
+}
+
+func (l *Limiter) observe(ctx context.Context, userKey string, results []RuleResult, err error) {
+	if len(l.observers) == 0 {
+		return
+	}
+	d := Decision{Key: userKey, Rules: l.rules, Results: results, Err: err}
+	for _, o := range l.observers {
+		o.Observe(ctx, d)
+	}
+}
+
+// AsyncObserver forwards decisions to another [Observer] on a background
+// goroutine through a bounded buffer, so a slow observer cannot delay
+// [Limiter.Check]. Decisions that find the buffer full are dropped and counted.
+// Create one with [NewAsyncObserver] and stop it with [AsyncObserver.Close].
+type AsyncObserver struct {
+	next    Observer
+	ch      chan asyncDecision
+	mu      sync.RWMutex // guards closed against concurrent sends on ch
+	closed  bool
+	dropped atomic.Uint64
+	done    chan struct{}
+}
+
+type asyncDecision struct {
+	ctx context.Context
+	d   Decision
+}
+
+// NewAsyncObserver starts a goroutine that passes decisions to next, buffering
+// up to buffer of them.
+func NewAsyncObserver(next Observer, buffer int) *AsyncObserver {
+	a := &AsyncObserver{
+		next: next,
+		ch:   make(chan asyncDecision, buffer),
+		done: make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *AsyncObserver) run() {
+	defer close(a.done)
+	for ad := range a.ch {
+		a.next.Observe(ad.ctx, ad.d)
+	}
+}
+
+// Observe queues d without blocking. The context passed on to the wrapped
+// observer keeps the values of ctx but is never canceled, since the request
+// that produced d has usually finished by then.
+func (a *AsyncObserver) Observe(ctx context.Context, d Decision) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		a.dropped.Add(1)
+		return
+	}
+	select {
+	case a.ch <- asyncDecision{ctx: context.WithoutCancel(ctx), d: d}:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many decisions were discarded because the buffer was
+// full or the observer was closed.
+func (a *AsyncObserver) Dropped() uint64 {
+	return a.dropped.Load()
+}
+
+// Close stops accepting decisions and waits until the queued ones have been
+// delivered. Close is idempotent.
+func (a *AsyncObserver) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.ch)
+	}
+	a.mu.Unlock()
+	<-a.done
+}
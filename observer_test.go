@@ -0,0 +1,102 @@
+package yarl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingObserver struct {
+	mu        sync.Mutex
+	decisions []Decision
+}
+
+func (o *recordingObserver) Observe(_ context.Context, d Decision) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.decisions = append(o.decisions, d)
+}
+
+func (o *recordingObserver) recorded() []Decision {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Decision(nil), o.decisions...)
+}
+
+func TestLimiter_Observers(t *testing.T) {
+	rules := []Rule{{ID: "r1", TTL: time.Minute, MaxRequests: 1}}
+	first := &recordingObserver{}
+	var order []string
+	l := NewWithOptions(newMockBackend(time.Minute, nil), rules,
+		WithObserver(first),
+		WithObserver(ObserverFunc(func(context.Context, Decision) { order = append(order, "second") })),
+	)
+
+	for range 2 {
+		_, err := l.Check(context.Background(), "alice")
+		require.NoError(t, err)
+	}
+
+	decisions := first.recorded()
+	require.Len(t, decisions, 2)
+	assert.Equal(t, "alice", decisions[0].Key)
+	assert.Equal(t, rules, decisions[0].Rules)
+	assert.True(t, decisions[0].Allowed())
+	assert.False(t, decisions[1].Allowed())
+	assert.Equal(t, int64(2), decisions[1].Results[0].Current)
+	assert.Len(t, order, 2)
+}
+
+func TestLimiter_ObserverSeesErrors(t *testing.T) {
+	backendErr := errors.New("down")
+	obs := &recordingObserver{}
+	l := NewWithOptions(newMockBackend(time.Minute, backendErr), []Rule{{ID: "r1", TTL: time.Minute, MaxRequests: 1}}, WithObserver(obs))
+
+	_, err := l.Check(context.Background(), "alice")
+	require.ErrorIs(t, err, backendErr)
+
+	decisions := obs.recorded()
+	require.Len(t, decisions, 1)
+	assert.ErrorIs(t, decisions[0].Err, backendErr)
+	assert.Nil(t, decisions[0].Results)
+	assert.False(t, decisions[0].Allowed())
+}
+
+func TestAsyncObserver(t *testing.T) {
+	release := make(chan struct{})
+	obs := &recordingObserver{}
+	a := NewAsyncObserver(ObserverFunc(func(ctx context.Context, d Decision) {
+		<-release
+		assert.NoError(t, ctx.Err(), "the request context must not cancel async delivery")
+		obs.Observe(ctx, d)
+	}), 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// One decision is taken by the blocked goroutine, two fill the buffer, the rest are dropped.
+	a.Observe(ctx, Decision{Key: "0"})
+	require.Eventually(t, func() bool { return len(a.ch) == 0 }, time.Second, time.Millisecond)
+	for _, k := range []string{"1", "2", "3", "4"} {
+		a.Observe(ctx, Decision{Key: k})
+	}
+	assert.Equal(t, uint64(2), a.Dropped())
+
+	close(release)
+	a.Close()
+	a.Close()
+
+	var keys []string
+	for _, d := range obs.recorded() {
+		keys = append(keys, d.Key)
+	}
+	assert.Equal(t, []string{"0", "1", "2"}, keys)
+
+	a.Observe(context.Background(), Decision{Key: "late"})
+	assert.Equal(t, uint64(3), a.Dropped(), "decisions after Close are dropped")
+}
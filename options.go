@@ -0,0 +1,28 @@
+package yarl
+
+// Option configures a [Limiter] created with [NewWithOptions].
+type Option func(*Limiter)
+
+// NewWithOptions creates a Limiter like [New] and applies opts to it.
+func NewWithOptions(b Backend, rules []Rule, opts ...Option) *Limiter {
+	l := New(b, rules...)
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// WithDryRun puts every rule of the Limiter in dry-run mode, as if each had
+// [Rule.DryRun] set: requests are counted and violations reported through
+// [RuleResult.WouldBlock], but never denied. The rules passed to
+// [NewWithOptions] are not modified.
+func WithDryRun() Option {
+	return func(l *Limiter) {
+		rules := make([]Rule, len(l.rules))
+		for i, r := range l.rules {
+			r.DryRun = true
+			rules[i] = r
+		}
+		l.rules = rules
+	}
+}
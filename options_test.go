@@ -0,0 +1,48 @@
+package yarl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_DryRunRule(t *testing.T) {
+	l := New(newMockBackend(30*time.Second, nil),
+		Rule{ID: "enforced", TTL: time.Minute, MaxRequests: 5},
+		Rule{ID: "shadow", TTL: time.Minute, MaxRequests: 1, DryRun: true},
+	)
+
+	_, err := l.Check(context.Background(), "alice")
+	require.NoError(t, err)
+	results, err := l.Check(context.Background(), "alice")
+	require.NoError(t, err)
+
+	shadow := results[1]
+	assert.True(t, shadow.Allowed)
+	assert.True(t, shadow.WouldBlock)
+	assert.Equal(t, int64(2), shadow.Current, "dry-run rules still count")
+	assert.Zero(t, shadow.RetryAfter)
+	assert.False(t, results[0].WouldBlock)
+
+	allowed, worst := Summarize(results)
+	assert.True(t, allowed)
+	assert.Nil(t, worst)
+}
+
+func TestWithDryRun(t *testing.T) {
+	rules := []Rule{{ID: "r1", TTL: time.Minute, MaxRequests: 1}}
+	l := NewWithOptions(peekBackend{newMockBackend(time.Minute, nil)}, rules, WithDryRun())
+	assert.False(t, rules[0].DryRun, "caller's rules must not be modified")
+
+	for range 3 {
+		require.NoError(t, l.Wait(context.Background(), "alice"), "dry-run limiters never block")
+	}
+
+	results, err := l.Peek(context.Background(), "alice")
+	require.NoError(t, err)
+	assert.True(t, results[0].Allowed)
+	assert.True(t, results[0].WouldBlock)
+}
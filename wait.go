@@ -0,0 +1,87 @@
+package yarl
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrWouldExceedDeadline is returned by [Limiter.Wait] when the context deadline
+// expires before the rate limit would admit the request.
+var ErrWouldExceedDeadline = errors.New("yarl: wait would exceed context deadline")
+
+// minRetryDelay bounds how soon [Limiter.Wait] retries when a backend reports a
+// violated rule with no remaining window (e.g. Redis TTL rounding to 0s).
+const minRetryDelay = 50 * time.Millisecond
+
+// Reservation is the outcome of [Limiter.Reserve].
+type Reservation struct {
+	// Results holds one [RuleResult] per Rule, as returned by [Limiter.Check].
+	Results []RuleResult
+	// Delay is 0 when the request was admitted. Otherwise it is the time to wait
+	// before trying again: the longest RetryAfter among the violated rules.
+	Delay time.Duration
+}
+
+// OK reports whether the request was admitted and may proceed now.
+func (r Reservation) OK() bool {
+	return r.Delay == 0
+}
+
+// Reserve runs [Limiter.Check] for userKey and reports how long the caller must
+// wait before trying again. Unlike golang.org/x/time/rate, quota in a fixed window
+// cannot be booked ahead: a Reservation with Delay > 0 holds no slot, and the
+// caller must call Reserve (or [Limiter.Wait]) again once Delay has elapsed.
+func (l *Limiter) Reserve(ctx context.Context, userKey string) (Reservation, error) {
+	results, err := l.Check(ctx, userKey)
+	if err != nil {
+		return Reservation{}, err
+	}
+	return Reservation{Results: results, Delay: retryDelay(results)}, nil
+}
+
+// Wait blocks until every Rule admits a request for userKey, sleeping until the
+// longest RetryAfter between attempts. It returns ctx.Err() if ctx is done while
+// waiting, and [ErrWouldExceedDeadline] without sleeping if the next attempt
+// would happen after the ctx deadline.
+//
+// Every attempt is counted like a [Limiter.Check] call, so a waiting caller also
+// consumes quota of the rules that were not violated. With fixed windows this is
+// at most one extra request per window of the violated rule.
+func (l *Limiter) Wait(ctx context.Context, userKey string) error {
+	for {
+		r, err := l.Reserve(ctx, userKey)
+		if err != nil {
+			return err
+		}
+		if r.OK() {
+			return nil
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < r.Delay {
+			return ErrWouldExceedDeadline
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.clock.After(r.Delay):
+		}
+	}
+}
+
+// retryDelay returns the longest RetryAfter among the violated rules, or 0 when
+// all rules passed.
+func retryDelay(results []RuleResult) time.Duration {
+	var delay time.Duration
+	allowed := true
+	for _, res := range results {
+		if !res.Allowed {
+			allowed = false
+			delay = max(delay, res.RetryAfter)
+		}
+	}
+	if allowed {
+		return 0
+	}
+	return max(delay, minRetryDelay)
+}
@@ -0,0 +1,115 @@
+package yarl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// windowBackend is a fixed-window backend on the real clock.
+type windowBackend struct {
+	mu      sync.Mutex
+	windows map[string]*window
+	calls   int
+}
+
+type window struct {
+	count     int64
+	expiresAt time.Time
+}
+
+func newWindowBackend() *windowBackend {
+	return &windowBackend{windows: make(map[string]*window)}
+}
+
+func (b *windowBackend) IncAndGetTTL(_ context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls++
+	now := time.Now()
+	w, ok := b.windows[key]
+	if !ok || !w.expiresAt.After(now) {
+		w = &window{expiresAt: now.Add(ttl)}
+		b.windows[key] = w
+	}
+	w.count++
+	return w.count, w.expiresAt.Sub(now), nil
+}
+
+func TestLimiter_Reserve(t *testing.T) {
+	ctx := context.Background()
+	l := New(newWindowBackend(),
+		Rule{ID: "burst", TTL: time.Second, MaxRequests: 1},
+		Rule{ID: "sustained", TTL: time.Minute, MaxRequests: 10},
+	)
+
+	r, err := l.Reserve(ctx, "u")
+	require.NoError(t, err)
+	assert.True(t, r.OK())
+	assert.Equal(t, time.Duration(0), r.Delay)
+	assert.Len(t, r.Results, 2)
+
+	r, err = l.Reserve(ctx, "u")
+	require.NoError(t, err)
+	assert.False(t, r.OK())
+	assert.Greater(t, r.Delay, 900*time.Millisecond)
+	assert.LessOrEqual(t, r.Delay, time.Second)
+}
+
+func TestLimiter_Reserve_BackendError(t *testing.T) {
+	l := New(newMockBackend(0, errors.New("down")), Rule{ID: "r", TTL: time.Minute, MaxRequests: 1})
+	_, err := l.Reserve(context.Background(), "u")
+	assert.Error(t, err)
+}
+
+func TestLimiter_Wait_BlocksUntilWindowResets(t *testing.T) {
+	ctx := context.Background()
+	b := newWindowBackend()
+	l := New(b, Rule{ID: "r", TTL: 100 * time.Millisecond, MaxRequests: 1})
+
+	require.NoError(t, l.Wait(ctx, "u"))
+
+	start := time.Now()
+	require.NoError(t, l.Wait(ctx, "u"))
+	assert.GreaterOrEqual(t, time.Since(start), 80*time.Millisecond, "second Wait must sleep until the window resets")
+	assert.Equal(t, 3, b.calls, "one denied attempt, then one admitted attempt")
+}
+
+func TestLimiter_Wait_ContextCanceled(t *testing.T) {
+	l := New(newWindowBackend(), Rule{ID: "r", TTL: time.Hour, MaxRequests: 0})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	assert.ErrorIs(t, l.Wait(ctx, "u"), context.Canceled)
+}
+
+func TestLimiter_Wait_WouldExceedDeadline(t *testing.T) {
+	l := New(newWindowBackend(), Rule{ID: "r", TTL: time.Hour, MaxRequests: 0})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	assert.ErrorIs(t, l.Wait(ctx, "u"), ErrWouldExceedDeadline)
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "Wait must fail fast instead of sleeping past the deadline")
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Duration(0), retryDelay(nil))
+	assert.Equal(t, time.Duration(0), retryDelay([]RuleResult{{Allowed: true}}))
+	assert.Equal(t, 3*time.Second, retryDelay([]RuleResult{
+		{Allowed: false, RetryAfter: time.Second},
+		{Allowed: true},
+		{Allowed: false, RetryAfter: 3 * time.Second},
+	}))
+	assert.Equal(t, minRetryDelay, retryDelay([]RuleResult{{Allowed: false}}), "a zero RetryAfter must not cause a busy loop")
+}
@@ -0,0 +1,45 @@
+package yarltest
+
+import (
+	"slices"
+	"testing"
+
+	yarl "github.com/logocomune/yarl/v4"
+)
+
+// RequireAllowed fails the test immediately unless every result is allowed.
+func RequireAllowed(t testing.TB, results []yarl.RuleResult) {
+	t.Helper()
+	if len(results) == 0 {
+		t.Fatal("yarltest: no results")
+	}
+	for _, r := range results {
+		if !r.Allowed {
+			t.Fatalf("yarltest: rule %q denied (%d/%d, retry after %s), want all rules allowed",
+				r.ID, r.Current, r.Max, r.RetryAfter)
+		}
+	}
+}
+
+// RequireDenied fails the test immediately unless at least one result is
+// denied. When ruleIDs are given, exactly those rules must be the denied ones.
+func RequireDenied(t testing.TB, results []yarl.RuleResult, ruleIDs ...string) {
+	t.Helper()
+	var denied []string
+	for _, r := range results {
+		if !r.Allowed {
+			denied = append(denied, r.ID)
+		}
+	}
+	if len(denied) == 0 {
+		t.Fatal("yarltest: all rules allowed, want a denial")
+	}
+	if len(ruleIDs) == 0 {
+		return
+	}
+	want := slices.Sorted(slices.Values(ruleIDs))
+	slices.Sort(denied)
+	if !slices.Equal(denied, want) {
+		t.Fatalf("yarltest: denied rules %q, want %q", denied, want)
+	}
+}
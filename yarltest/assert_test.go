@@ -0,0 +1,57 @@
+package yarltest
+
+import (
+	"fmt"
+	"testing"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// fatalRecorder captures Fatal calls instead of failing the enclosing test.
+type fatalRecorder struct {
+	testing.TB
+	msg string
+}
+
+func (r *fatalRecorder) Helper() {}
+
+func (r *fatalRecorder) Fatal(args ...any) {
+	r.msg = fmt.Sprint(args...)
+	panic(r)
+}
+
+func (r *fatalRecorder) Fatalf(format string, args ...any) {
+	r.msg = fmt.Sprintf(format, args...)
+	panic(r)
+}
+
+// failure runs f and returns the Fatal message it produced, or "".
+func failure(f func(t testing.TB)) (msg string) {
+	r := &fatalRecorder{}
+	defer func() {
+		if recover() != nil {
+			msg = r.msg
+		}
+	}()
+	f(r)
+	return ""
+}
+
+func TestRequireAllowed(t *testing.T) {
+	allowed := []yarl.RuleResult{{ID: "burst", Allowed: true}, {ID: "daily", Allowed: true}}
+	denied := []yarl.RuleResult{{ID: "burst", Allowed: false, Current: 4, Max: 3}, {ID: "daily", Allowed: true}}
+
+	assert.Empty(t, failure(func(t testing.TB) { RequireAllowed(t, allowed) }))
+	assert.Contains(t, failure(func(t testing.TB) { RequireAllowed(t, denied) }), `rule "burst" denied (4/3`)
+	assert.Contains(t, failure(func(t testing.TB) { RequireAllowed(t, nil) }), "no results")
+}
+
+func TestRequireDenied(t *testing.T) {
+	results := []yarl.RuleResult{{ID: "burst", Allowed: false}, {ID: "daily", Allowed: true}}
+
+	assert.Empty(t, failure(func(t testing.TB) { RequireDenied(t, results) }))
+	assert.Empty(t, failure(func(t testing.TB) { RequireDenied(t, results, "burst") }))
+	assert.Contains(t, failure(func(t testing.TB) { RequireDenied(t, results, "daily") }), `denied rules ["burst"], want ["daily"]`)
+	assert.Contains(t, failure(func(t testing.TB) { RequireDenied(t, results[1:]) }), "want a denial")
+}
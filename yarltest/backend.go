@@ -0,0 +1,187 @@
+package yarltest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+)
+
+var (
+	_ yarl.PeekBackend   = (*Backend)(nil)
+	_ yarl.ResetBackend  = (*Backend)(nil)
+	_ yarl.RefundBackend = (*Backend)(nil)
+)
+
+// Operations recorded in [Call.Op].
+const (
+	OpIncAndGetTTL = "IncAndGetTTL"
+	OpGet          = "Get"
+	OpReset        = "Reset"
+	OpDecrement    = "Decrement"
+)
+
+// Call is one recorded call to a [Backend].
+type Call struct {
+	Op  string
+	Key string
+	TTL time.Duration // IncAndGetTTL only
+}
+
+// Backend is a deterministic in-memory [yarl.Backend] for tests. Counters live
+// in a map and expire on a fake [Clock]; errors and latency can be injected and
+// every call is recorded. It also implements [yarl.PeekBackend],
+// [yarl.ResetBackend] and [yarl.RefundBackend]. Create one with [NewBackend].
+// It is safe for concurrent use.
+type Backend struct {
+	clock *Clock
+
+	mu      sync.Mutex
+	windows map[string]*window
+	calls   []Call
+	err     error
+	latency time.Duration
+}
+
+type window struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// NewBackend creates a Backend whose windows expire on clock. A nil clock gets a
+// new [Clock] from NewClock(time.Time{}); read it back with [Backend.Clock].
+// Pass the same clock to [yarl.WithClock] so results and windows agree.
+func NewBackend(clock *Clock) *Backend {
+	if clock == nil {
+		clock = NewClock(time.Time{})
+	}
+	return &Backend{clock: clock, windows: make(map[string]*window)}
+}
+
+// Clock returns the clock the backend's windows expire on.
+func (b *Backend) Clock() *Clock {
+	return b.clock
+}
+
+// FailWith makes every following call return err, until FailWith(nil).
+// Calls are still recorded.
+func (b *Backend) FailWith(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err = err
+}
+
+// Delay makes every following call wait d of real time before running, or
+// return ctx.Err() if ctx is done first. Use it to test timeouts; Delay(0) removes it.
+func (b *Backend) Delay(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.latency = d
+}
+
+// Calls returns a copy of the calls recorded so far, in order.
+func (b *Backend) Calls() []Call {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Call(nil), b.calls...)
+}
+
+// Count returns the live counter of key without recording a call, e.g. to
+// assert that a handler consumed quota. key has the format "{ruleID}:{userKey}".
+func (b *Backend) Count(key string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if w := b.live(key); w != nil {
+		return w.count
+	}
+	return 0
+}
+
+// IncAndGetTTL implements [yarl.Backend].
+func (b *Backend) IncAndGetTTL(ctx context.Context, key string, ttl time.Duration) (int64, time.Duration, error) {
+	if err := b.begin(ctx, Call{Op: OpIncAndGetTTL, Key: key, TTL: ttl}); err != nil {
+		return 0, 0, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	w := b.live(key)
+	if w == nil {
+		w = &window{expiresAt: now.Add(ttl)}
+		b.windows[key] = w
+	}
+	w.count++
+	return w.count, w.expiresAt.Sub(now), nil
+}
+
+// Get implements [yarl.PeekBackend].
+func (b *Backend) Get(ctx context.Context, key string) (int64, time.Duration, error) {
+	if err := b.begin(ctx, Call{Op: OpGet, Key: key}); err != nil {
+		return 0, 0, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	w := b.live(key)
+	if w == nil {
+		return 0, 0, nil
+	}
+	return w.count, w.expiresAt.Sub(b.clock.Now()), nil
+}
+
+// Reset implements [yarl.ResetBackend].
+func (b *Backend) Reset(ctx context.Context, key string) error {
+	if err := b.begin(ctx, Call{Op: OpReset, Key: key}); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.windows, key)
+	return nil
+}
+
+// Decrement implements [yarl.RefundBackend].
+func (b *Backend) Decrement(ctx context.Context, key string) error {
+	if err := b.begin(ctx, Call{Op: OpDecrement, Key: key}); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if w := b.live(key); w != nil && w.count > 0 {
+		w.count--
+	}
+	return nil
+}
+
+// begin records c, then applies the injected latency and error.
+func (b *Backend) begin(ctx context.Context, c Call) error {
+	b.mu.Lock()
+	b.calls = append(b.calls, c)
+	latency, err := b.latency, b.err
+	b.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// live returns the window of key unless it is missing or expired. Callers must hold b.mu.
+func (b *Backend) live(key string) *window {
+	w, ok := b.windows[key]
+	if !ok || !w.expiresAt.After(b.clock.Now()) {
+		return nil
+	}
+	return w
+}
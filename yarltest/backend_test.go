@@ -0,0 +1,80 @@
+package yarltest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend(t *testing.T) {
+	ctx := context.Background()
+	b := NewBackend(nil)
+	rules := []yarl.Rule{{ID: "r1", TTL: time.Minute, MaxRequests: 1}}
+	l := yarl.NewWithOptions(b, rules, yarl.WithClock(b.Clock()))
+
+	results, err := l.Check(ctx, "alice")
+	require.NoError(t, err)
+	RequireAllowed(t, results)
+
+	b.Clock().Advance(10 * time.Second)
+	results, err = l.Check(ctx, "alice")
+	require.NoError(t, err)
+	RequireDenied(t, results, "r1")
+	assert.Equal(t, 50*time.Second, results[0].RetryAfter)
+	assert.Equal(t, int64(2), b.Count("r1:alice"))
+
+	b.Clock().Advance(50 * time.Second)
+	assert.Zero(t, b.Count("r1:alice"), "window expired")
+
+	require.NoError(t, l.Reset(ctx, "alice"))
+	assert.Equal(t, []Call{
+		{Op: OpIncAndGetTTL, Key: "r1:alice", TTL: time.Minute},
+		{Op: OpIncAndGetTTL, Key: "r1:alice", TTL: time.Minute},
+		{Op: OpReset, Key: "r1:alice"},
+	}, b.Calls())
+}
+
+func TestBackend_Decrement(t *testing.T) {
+	ctx := context.Background()
+	b := NewBackend(nil)
+
+	b.IncAndGetTTL(ctx, "r1:alice", time.Minute)
+	require.NoError(t, b.Decrement(ctx, "r1:alice"))
+	require.NoError(t, b.Decrement(ctx, "r1:alice"))
+	assert.Zero(t, b.Count("r1:alice"), "counters must not go below 0")
+	require.NoError(t, b.Decrement(ctx, "r1:missing"))
+	assert.Equal(t, OpDecrement, b.Calls()[1].Op)
+}
+
+func TestBackend_FailWith(t *testing.T) {
+	errDown := errors.New("down")
+	b := NewBackend(nil)
+
+	b.FailWith(errDown)
+	_, _, err := b.IncAndGetTTL(context.Background(), "r1:alice", time.Minute)
+	assert.ErrorIs(t, err, errDown)
+	_, _, err = b.Get(context.Background(), "r1:alice")
+	assert.ErrorIs(t, err, errDown)
+
+	b.FailWith(nil)
+	count, _, err := b.IncAndGetTTL(context.Background(), "r1:alice", time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count, "failed calls must not count")
+	assert.Len(t, b.Calls(), 3)
+}
+
+func TestBackend_Delay(t *testing.T) {
+	b := NewBackend(nil)
+	b.Delay(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err := b.IncAndGetTTL(ctx, "r1:alice", time.Minute)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Zero(t, b.Count("r1:alice"))
+}
@@ -0,0 +1,83 @@
+// Package yarltest provides helpers for testing code that uses YARL.
+package yarltest
+
+import (
+	"sync"
+	"time"
+
+	yarl "github.com/logocomune/yarl/v4"
+)
+
+var _ yarl.Clock = (*Clock)(nil)
+
+// Clock is a fake [yarl.Clock] that only moves when told to. Pass it to
+// [yarl.WithClock] and to the backend (e.g. lrubackend.WithClock) and call
+// [Clock.Advance] to expire windows instantly.
+// Create one with [NewClock]. It is safe for concurrent use.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewClock returns a Clock set to t. A zero t starts the clock at
+// 2024-01-01 00:00:00 UTC, so results do not depend on when the test runs.
+func NewClock(t time.Time) *Clock {
+	if t.IsZero() {
+		t = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return &Clock{now: t}
+}
+
+// Now returns the clock's current time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the clock's time once it has been
+// advanced by at least d. A non-positive d fires immediately.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, waiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d and fires the [Clock.After] channels
+// that became due.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+// Waiters returns how many [Clock.After] channels have not fired yet. Tests use
+// it to wait until a goroutine blocked in [yarl.Limiter.Wait] before advancing.
+func (c *Clock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
@@ -0,0 +1,36 @@
+package yarltest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock(t *testing.T) {
+	c := NewClock(time.Time{})
+	start := c.Now()
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), start)
+
+	select {
+	case now := <-c.After(0):
+		assert.Equal(t, start, now)
+	default:
+		t.Fatal("After(0) must fire immediately")
+	}
+
+	short, long := c.After(time.Second), c.After(time.Minute)
+	assert.Equal(t, 2, c.Waiters())
+
+	c.Advance(999 * time.Millisecond)
+	assert.Empty(t, short)
+
+	c.Advance(time.Millisecond)
+	assert.Equal(t, start.Add(time.Second), <-short)
+	assert.Empty(t, long)
+	assert.Equal(t, 1, c.Waiters())
+
+	c.Advance(time.Hour)
+	assert.Equal(t, start.Add(time.Hour+time.Second), <-long)
+	assert.Zero(t, c.Waiters())
+}